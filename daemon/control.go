@@ -0,0 +1,162 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/krap/root"
+	"github.com/roidaradal/krap/sys"
+)
+
+var (
+	ErrNotRunning      = errors.New("daemon is not running")
+	errInvalidInterval = errors.New("interval must be positive")
+)
+
+// Starts a run now, following the overlap policy; runs even if paused.
+// Returns ErrNotRunning if the daemon is stopped or stopping
+func (h *Handle) Trigger() error {
+	if !h.dispatch() {
+		return fmt.Errorf("%w: %s", ErrNotRunning, h.name)
+	}
+	return nil
+}
+
+// Skip scheduled runs until resumed; in-progress runs continue
+func (h *Handle) Pause() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.paused = true
+}
+
+// Resume scheduled runs
+func (h *Handle) Resume() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.paused = false
+}
+
+// Check if daemon is paused
+func (h *Handle) IsPaused() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.paused
+}
+
+// Replace the daemon schedule; the next run is rescheduled from the last run
+func (h *Handle) SetSchedule(schedule Schedule) {
+	h.mu.Lock()
+	h.schedule = schedule
+	h.mu.Unlock()
+	h.reschedule()
+}
+
+// Signal the loop to recompute the next run from the last run
+func (h *Handle) reschedule() {
+	select {
+	case h.wake <- struct{}{}:
+	default: // loop already signalled
+	}
+}
+
+// Replace the daemon schedule with a fixed interval, aligned if Options.Align
+func (h *Handle) SetInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return errInvalidInterval
+	}
+	h.SetSchedule(newIntervalSchedule(interval, &h.opts))
+	return nil
+}
+
+// Get the current schedule
+func (h *Handle) getSchedule() Schedule {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.schedule
+}
+
+// Starts a run of the daemon now
+func Trigger(name string) error {
+	h, ok := daemons.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRunning, name)
+	}
+	return h.Trigger()
+}
+
+// Pause the daemon's scheduled runs
+func Pause(name string) error {
+	return withHandle(name, (*Handle).Pause)
+}
+
+// Resume the daemon's scheduled runs
+func Resume(name string) error {
+	return withHandle(name, (*Handle).Resume)
+}
+
+// Replace the daemon's schedule with a fixed interval
+func SetInterval(name string, interval time.Duration) error {
+	h, ok := daemons.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRunning, name)
+	}
+	return h.SetInterval(interval)
+}
+
+// Root commands: daemon/list, daemon/run, daemon/pause, daemon/resume
+func Commands() []*root.CmdConfig {
+	return []*root.CmdConfig{
+		root.NewCommand("daemon/list", 0, "List running daemons", func([]string) {
+			displayList()
+		}),
+		root.NewCommand("daemon/run", 1, "<NAME> Run daemon now", func(params []string) {
+			sys.DisplayOutput(nil, Trigger(params[0]))
+		}),
+		root.NewCommand("daemon/pause", 1, "<NAME> Pause daemon's scheduled runs", func(params []string) {
+			sys.DisplayOutput(nil, Pause(params[0]))
+		}),
+		root.NewCommand("daemon/resume", 1, "<NAME> Resume daemon's scheduled runs", func(params []string) {
+			sys.DisplayOutput(nil, Resume(params[0]))
+		}),
+	}
+}
+
+// Common: calls action on the daemon's handle
+func withHandle(name string, action func(*Handle)) error {
+	h, ok := daemons.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotRunning, name)
+	}
+	action(h)
+	return nil
+}
+
+// Prints one line per running daemon, sorted by name
+func displayList() {
+	info := All()
+	names := make([]string, 0, len(info))
+	for name := range info {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		item := info[name]
+		status := "active"
+		if item.Paused {
+			status = "paused"
+		}
+		var last, next string
+		if !item.Last.IsZero() {
+			last = clock.StandardFormat(item.Last)
+		}
+		if !item.NextRun.IsZero() {
+			next = clock.StandardFormat(item.NextRun)
+		}
+		fmt.Printf("%s [%s] schedule=%s last=%s next=%s runs=%d failures=%d avg=%v p95=%v\n",
+			name, status, item.Schedule, last, next, item.Runs, item.Failures, item.Stats.Average, item.Stats.P95)
+	}
+	fmt.Println("Count:", len(names))
+}
@@ -0,0 +1,251 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cronTZPrefix string = "CRON_TZ="
+
+var errInvalidCron = errors.New("invalid cron expression")
+
+// Cron expression shortcuts
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{"", "JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	dayNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+// When a daemon runs
+type Schedule interface {
+	// Time of the run after the run that started at last
+	Next(last time.Time) time.Time
+	String() string
+}
+
+// Fixed interval schedule: runs immediately, then every interval after each run's start
+type intervalSchedule time.Duration
+
+// Start of the last run + interval
+func (s intervalSchedule) Next(last time.Time) time.Time {
+	return last.Add(time.Duration(s))
+}
+
+// Interval as text
+func (s intervalSchedule) String() string {
+	return time.Duration(s).String()
+}
+
+// Interval schedule aligned to wall-clock boundaries: runs at multiples of interval
+// counted from midnight in location, e.g. 1h runs on the hour
+type alignedSchedule struct {
+	interval time.Duration
+	location *time.Location
+}
+
+// First boundary after last
+func (s alignedSchedule) Next(last time.Time) time.Time {
+	t := last.In(s.location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+	elapsed := t.Sub(midnight)
+	return midnight.Add((elapsed/s.interval + 1) * s.interval)
+}
+
+// Interval as text
+func (s alignedSchedule) String() string {
+	return s.interval.String() + " aligned"
+}
+
+// Cron schedule: minute hour day-of-month month day-of-week, in a timezone
+type Cron struct {
+	expr     string
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	anyDOM   bool // day-of-month is *
+	anyDOW   bool // day-of-week is *
+	anyHour  bool // hour is * or */n
+	location *time.Location
+}
+
+// Parse 5-field cron expression, e.g. "0 3 * * *", "*/15 * * * 1-5";
+// fields support *, lists (a,b), ranges (a-b), steps (*/n, a-b/n), and month / day names (JAN, MON).
+// Also accepts @yearly, @monthly, @weekly, @daily, @hourly, and a CRON_TZ=<Zone> prefix
+// which overrides the given location (nil = time.Local)
+func ParseCron(expr string, location *time.Location) (*Cron, error) {
+	text := strings.TrimSpace(expr)
+	if strings.HasPrefix(text, cronTZPrefix) {
+		zone, rest, _ := strings.Cut(strings.TrimPrefix(text, cronTZPrefix), " ")
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", errInvalidCron, expr, err)
+		}
+		location, text = loc, strings.TrimSpace(rest)
+	}
+	if macro, ok := cronMacros[text]; ok {
+		text = macro
+	}
+	fields := strings.Fields(text)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q: expected 5 fields", errInvalidCron, expr)
+	}
+	if location == nil {
+		location = time.Local
+	}
+	c := &Cron{
+		expr:     expr,
+		anyDOM:   fields[2] == "*",
+		anyDOW:   fields[4] == "*",
+		anyHour:  strings.HasPrefix(fields[1], "*"),
+		location: location,
+	}
+	var err error
+	fieldBits := []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	limits := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	names := [][]string{nil, nil, nil, monthNames, dayNames}
+	for i, field := range fields {
+		*fieldBits[i], err = parseCronField(field, limits[i][0], limits[i][1], names[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", errInvalidCron, expr, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 // 7 is also Sunday
+	}
+	return c, nil
+}
+
+// Get the first matching minute after last, in the cron's timezone;
+// zero time if there is no match within 5 years.
+// On DST changes: times in a skipped hour do not run that day, and times in a repeated hour
+// run once, unless the hour is * or */n (then the repeated hour runs again)
+func (c *Cron) Next(last time.Time) time.Time {
+	t := last.In(c.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !hasBit(c.month, int(t.Month())) {
+			t = c.startOfDay(t.Year(), t.Month()+1, 1)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = c.startOfDay(t.Year(), t.Month(), t.Day()+1)
+			continue
+		}
+		if !hasBit(c.hour, t.Hour()) || (!c.anyHour && isRepeatedHour(t)) {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute) // next hour, even if skipped or repeated
+			continue
+		}
+		if !hasBit(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Get the first existing minute of the date (normalized) in the cron's timezone,
+// which is after midnight if midnight is skipped by a DST change
+func (c *Cron) startOfDay(year int, month time.Month, day int) time.Time {
+	year, month, day = time.Date(year, month, day, 12, 0, 0, 0, c.location).Date()
+	t := time.Date(year, month, day, 0, 0, 0, 0, c.location)
+	for t.Day() != day {
+		t = t.Add(time.Hour) // normalized to the previous day: walk into the date
+	}
+	return t
+}
+
+// Check if t is in the second pass of an hour repeated by a DST change
+func isRepeatedHour(t time.Time) bool {
+	prev := t.Add(-time.Hour)
+	return prev.Hour() == t.Hour() && prev.Minute() == t.Minute()
+}
+
+// Cron expression
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Check day-of-month and day-of-week: if both are restricted, either can match
+func (c *Cron) matchDay(t time.Time) bool {
+	domMatch := hasBit(c.dom, t.Day())
+	dowMatch := hasBit(c.dow, int(t.Weekday()))
+	if c.anyDOM || c.anyDOW {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Parse comma-separated cron field items into a bitset
+func parseCronField(field string, low, high int, names []string) (uint64, error) {
+	var bits uint64
+	for item := range strings.SplitSeq(field, ",") {
+		rangeText, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", item)
+			}
+		}
+		start, end := low, high
+		if rangeText != "*" {
+			startText, endText, isRange := strings.Cut(rangeText, "-")
+			var err error
+			start, err = parseCronValue(startText, low, high, names)
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				end, err = parseCronValue(endText, low, high, names)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = high // a/n = a-high/n
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range %q", item)
+			}
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// Parse cron field number or name within [low, high]
+func parseCronValue(text string, low, high int, names []string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(text, name) {
+			return i, nil
+		}
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < low || value > high {
+		return 0, fmt.Errorf("invalid value %q, expected %d-%d", text, low, high)
+	}
+	return value, nil
+}
+
+// Check if bit is set
+func hasBit(bits uint64, bit int) bool {
+	return bits&(1<<bit) != 0
+}
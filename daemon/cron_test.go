@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	santiago := mustLoadLocation(t, "America/Santiago")
+	testCases := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		last string
+		want string
+	}{
+		{"every minute", "* * * * *", time.UTC, "2026-01-01 10:00:30", "2026-01-01 10:01:00"},
+		{"daily", "0 3 * * *", time.UTC, "2026-01-01 03:00:00", "2026-01-02 03:00:00"},
+		{"minute step", "*/15 * * * *", time.UTC, "2026-01-01 10:16:00", "2026-01-01 10:30:00"},
+		{"range step", "0 9-17/4 * * *", time.UTC, "2026-01-01 13:00:00", "2026-01-01 17:00:00"},
+		{"range step wraps day", "0 9-17/4 * * *", time.UTC, "2026-01-01 17:00:00", "2026-01-02 09:00:00"},
+		{"list", "5,10 * * * *", time.UTC, "2026-01-01 10:05:00", "2026-01-01 10:10:00"},
+		{"month and day names", "0 0 * FEB MON", time.UTC, "2026-01-01 00:00:00", "2026-02-02 00:00:00"},
+		{"month range", "0 0 1 JUN-AUG *", time.UTC, "2026-06-01 00:00:00", "2026-07-01 00:00:00"},
+		{"sunday as 7", "0 0 * * 7", time.UTC, "2026-01-01 00:00:00", "2026-01-04 00:00:00"},
+		{"dom or dow: dom first", "0 0 13 * FRI", time.UTC, "2026-01-10 00:00:00", "2026-01-13 00:00:00"},
+		{"dom or dow: dow first", "0 0 13 * FRI", time.UTC, "2026-01-13 00:00:00", "2026-01-16 00:00:00"},
+		{"dom and any dow", "0 0 31 * *", time.UTC, "2026-01-31 00:00:00", "2026-03-31 00:00:00"},
+		{"leap day", "0 0 29 2 *", time.UTC, "2026-01-01 00:00:00", "2028-02-29 00:00:00"},
+		{"macro", "@hourly", time.UTC, "2026-01-01 10:00:00", "2026-01-01 11:00:00"},
+		{"timezone", "0 3 * * *", newYork, "2026-01-01 00:00:00", "2026-01-01 08:00:00"},
+		{"cron tz prefix", "CRON_TZ=America/New_York 0 3 * * *", time.UTC, "2026-01-01 00:00:00", "2026-01-01 08:00:00"},
+		{"dst gap: after skipped hour", "0 3 * * *", newYork, "2026-03-08 04:59:00", "2026-03-08 07:00:00"},
+		{"dst gap: in skipped hour", "30 2 * * *", newYork, "2026-03-08 05:00:00", "2026-03-09 06:30:00"},
+		{"dst gap: hourly", "0 * * * *", newYork, "2026-03-08 06:00:00", "2026-03-08 07:00:00"},
+		{"dst overlap: fixed hour runs once", "30 1 * * *", newYork, "2026-11-01 05:30:00", "2026-11-02 06:30:00"},
+		{"dst overlap: any hour repeats", "*/30 * * * *", newYork, "2026-11-01 05:30:00", "2026-11-01 06:00:00"},
+		{"dst gap at midnight", "0 * * * *", santiago, "2026-09-06 03:00:00", "2026-09-06 04:00:00"},
+		{"dst gap at midnight: daily", "0 0 * * *", santiago, "2026-09-05 04:00:00", "2026-09-07 03:00:00"},
+		{"no match", "0 0 30 2 *", time.UTC, "2026-01-01 00:00:00", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ParseCron(tc.expr, tc.loc)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error: %v", tc.expr, err)
+			}
+			got := c.Next(mustParseUTC(t, tc.last))
+			if tc.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next(%s) = %v, want zero", tc.last, got)
+				}
+				return
+			}
+			if want := mustParseUTC(t, tc.want); !got.Equal(want) {
+				t.Errorf("Next(%s) = %v, want %v", tc.last, got.UTC(), want)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * FOO *", "CRON_TZ=Nowhere/City * * * * *"} {
+		if _, err := ParseCron(expr, nil); err == nil {
+			t.Errorf("ParseCron(%q) = nil error, want error", expr)
+		}
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func mustParseUTC(t *testing.T, text string) time.Time {
+	t.Helper()
+	value, err := time.Parse(time.DateTime, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
@@ -1,22 +1,31 @@
 package daemon
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/roidaradal/fn/clock"
 	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/fn/fail"
 	"github.com/roidaradal/fn/io"
+	"github.com/roidaradal/rdb/ze"
 )
 
 /*
 Note: DaemonConfig is expected to have this structure:
 Use int for Interval and Margin values so that we can disable
-a daemon by setting the value to -1 or any value < 0
+a daemon by setting the value to -1 or any value < 0;
+use Spec for values that can be an int interval or a cron string,
+or an object that also sets the first run delay, jitter, and alignment
 
 type Config sturct {
 	<Domain> struct {
 		<FeatureInterval> int
+		<FeatureSchedule> daemon.Spec // 15 or "0 3 * * *"
+		<FeatureSpread>   daemon.Spec // {"Interval": 60, "Delay": "30s", "Jitter": "1m", "Align": true}
 		...
 	}
 	...
@@ -24,74 +33,243 @@ type Config sturct {
 */
 
 var (
-	daemonStart    = dict.NewSyncMap[string, time.Time]()
-	daemonLast     = dict.NewSyncMap[string, time.Time]()
-	daemonDuration = dict.NewSyncMap[string, time.Duration]()
+	errZeroInterval     = errors.New("interval must not be 0")
+	errNegativeDuration = errors.New("delay and jitter must not be negative")
+	errAlignCron        = errors.New("align is only for interval schedules")
 )
 
+// Initialize the daemon package
+func Initialize() error {
+	errs := make([]error, 0)
+
+	LeaseSchema = ze.AddSchema(&Lease{}, "daemon_leases", errs)
+	JobSchema = ze.AddSchema(&Job{}, "daemon_jobs", errs)
+
+	if len(errs) > 0 {
+		return fail.FromErrors("daemon.Initialize", errs)
+	}
+
+	return nil
+}
+
+// Daemon config value: int Interval (< 0 = disabled) or Cron expression,
+// with optional first run Delay, Jitter, and Align (see Options);
+// in JSON, a number, a string, or an object with duration strings, e.g. "30s"
+type Spec struct {
+	Interval int
+	Cron     string
+	Delay    time.Duration
+	Jitter   time.Duration
+	Align    bool
+}
+
+// JSON object form of Spec
+type specObject struct {
+	Interval int    `json:",omitempty"`
+	Cron     string `json:",omitempty"`
+	Delay    string `json:",omitempty"`
+	Jitter   string `json:",omitempty"`
+	Align    bool   `json:",omitempty"`
+}
+
+// Read Spec from JSON number, string, or object
+func (s *Spec) UnmarshalJSON(data []byte) error {
+	*s = Spec{}
+	if len(data) == 0 {
+		return json.Unmarshal(data, &s.Interval)
+	}
+	switch data[0] {
+	case '"':
+		return json.Unmarshal(data, &s.Cron)
+	case '{':
+		var obj specObject
+		err := json.Unmarshal(data, &obj)
+		if err != nil {
+			return err
+		}
+		s.Interval, s.Cron, s.Align = obj.Interval, obj.Cron, obj.Align
+		s.Delay, err = parseSpecDuration(obj.Delay)
+		if err != nil {
+			return err
+		}
+		s.Jitter, err = parseSpecDuration(obj.Jitter)
+		return err
+	}
+	return json.Unmarshal(data, &s.Interval)
+}
+
+// Write Spec as JSON number or string, or object if Delay, Jitter, or Align is set
+func (s Spec) MarshalJSON() ([]byte, error) {
+	if s.Delay != 0 || s.Jitter != 0 || s.Align {
+		obj := specObject{Interval: s.Interval, Cron: s.Cron, Align: s.Align}
+		if s.Delay != 0 {
+			obj.Delay = s.Delay.String()
+		}
+		if s.Jitter != 0 {
+			obj.Jitter = s.Jitter.String()
+		}
+		return json.Marshal(obj)
+	}
+	if s.Cron != "" {
+		return json.Marshal(s.Cron)
+	}
+	return json.Marshal(s.Interval)
+}
+
+// Check if Spec is valid: non-zero Interval or valid Cron expression,
+// non-negative Delay and Jitter, Align only for intervals
+func (s Spec) Validate() error {
+	if s.Delay < 0 || s.Jitter < 0 {
+		return errNegativeDuration
+	}
+	if s.Cron != "" {
+		if s.Align {
+			return errAlignCron
+		}
+		_, err := ParseCron(s.Cron, nil)
+		return err
+	}
+	if s.Interval == 0 {
+		return errZeroInterval
+	}
+	return nil
+}
+
+// Check if Spec runs the daemon: Cron expression or non-negative Interval
+func (s Spec) isEnabled() bool {
+	return s.Cron != "" || s.Interval >= 0
+}
+
+// Get a copy of opts with the Spec's Delay, Jitter, and Align applied
+func (s Spec) options(opts *Options) *Options {
+	options := Options{}
+	if opts != nil {
+		options = *opts
+	}
+	if s.Delay != 0 {
+		options.InitialDelay = s.Delay
+	}
+	if s.Jitter != 0 {
+		options.Jitter = s.Jitter
+	}
+	options.Align = options.Align || s.Align
+	return &options
+}
+
+// Parse optional duration string, empty = 0
+func parseSpecDuration(text string) (time.Duration, error) {
+	if text == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(text)
+}
+
 // Load Daemon Config which follows the expected structure,
-// Validates if any of the Interval values are 0 (invalid)
+// Validates if any of the Interval values are 0, any of the Cron values are invalid,
+// or any of the Delay and Jitter values are negative
 func LoadConfig[T any](path string) (*T, error) {
 	cfg, err := io.ReadJSON[T](path)
 	if err != nil {
 		return nil, err
 	}
-	cfgMap, err := dict.FromStruct[T, map[string]int](cfg)
+	_, err = configSpecs(cfg)
 	if err != nil {
 		return nil, err
 	}
+	return cfg, nil
+}
+
+// Get the validated Specs of the Daemon Config, keyed by <Domain>.<Key>
+func configSpecs[T any](cfg *T) (map[string]Spec, error) {
+	cfgMap, err := dict.FromStruct[T, map[string]Spec](cfg)
+	if err != nil {
+		return nil, err
+	}
+	specs := make(map[string]Spec)
 	for key := range cfgMap {
-		for cfgKey, value := range cfgMap[key] {
-			if value == 0 {
-				return nil, fmt.Errorf("invalid daemon %s.%s: %d", key, cfgKey, value)
+		for cfgKey, spec := range cfgMap[key] {
+			if err := spec.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid daemon %s.%s: %w", key, cfgKey, err)
 			}
+			specs[key+"."+cfgKey] = spec
 		}
 	}
-	return cfg, nil
+	return specs, nil
 }
 
-// Runs a task every given interval,
+// Runs a task every given interval, returns the daemon handle (nil if disabled);
 // TimeScale = time.Hour, time.Minute, time.Second
-func Run(name string, task func(), interval int, timeScale time.Duration) {
-	if interval < 0 {
-		fmt.Printf("Daemon:%s is disabled\n", name)
-		return
-	}
-	timeInterval := time.Duration(interval) * timeScale
-	daemonStart.Set(name, clock.Now())
-	daemonDuration.Set(name, timeInterval)
-	go func() {
-		for {
-			start := clock.Now()
-			daemonLast.Set(name, start)
-			task()
-			clock.Sleep(timeInterval, start)
-		}
-	}()
+func Run(name string, task func(), interval int, timeScale time.Duration) *Handle {
+	return RunContext(name, func(context.Context) {
+		task()
+	}, interval, timeScale)
+}
+
+// Runs a context-aware task every given interval, returns the daemon handle (nil if disabled);
+// the context is cancelled when the daemon is stopped.
+// TimeScale = time.Hour, time.Minute, time.Second
+func RunContext(name string, task func(context.Context), interval int, timeScale time.Duration) *Handle {
+	return RunTask(name, func(ctx context.Context) error {
+		task(ctx)
+		return nil
+	}, interval, timeScale, nil)
+}
+
+// Why the daemon loop woke up
+type wakeReason int
+
+const (
+	wakeDue        wakeReason = iota // next run is due
+	wakeStop                         // daemon is stopped
+	wakeReschedule                   // schedule or failure streak changed
+)
+
+// Sleeps until the given time (forever if zero), or until ctx is cancelled or wake is signalled
+func sleepUntil(ctx context.Context, next time.Time, wake <-chan struct{}) wakeReason {
+	if ctx.Err() != nil {
+		return wakeStop
+	}
+	var due <-chan time.Time
+	if !next.IsZero() {
+		timer := time.NewTimer(max(next.Sub(clock.Now()), 0))
+		defer timer.Stop()
+		due = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return wakeStop
+	case <-wake:
+		return wakeReschedule
+	case <-due:
+		return wakeDue
+	}
 }
 
+// Daemon info, History is latest first
 type Info struct {
-	Start    string
-	Last     string
-	Duration string
+	Start               time.Time
+	Last                time.Time     // start of last run
+	Duration            time.Duration // interval, 0 for cron schedules
+	Schedule            string
+	Paused              bool
+	IsLeader            bool // currently holds the lease, if Options.Lease is set
+	NextRun             time.Time
+	Runs                int
+	Failures            int
+	ConsecutiveFailures int
+	Timeouts            int
+	Skipped             int
+	LastError           string
+	LastSuccess         time.Time
+	Stats               Stats
+	History             []RunRecord
 }
 
 // Returns info on all running daemons
 func All() map[string]Info {
-	startTime := daemonStart.Map()
-	lastTime := daemonLast.Map()
-	durations := daemonDuration.Map()
 	info := make(map[string]Info)
-	for name, startTime := range startTime {
-		start := clock.StandardFormat(startTime)
-		var last, duration string
-		if dict.HasKey(lastTime, name) {
-			last = clock.StandardFormat(lastTime[name])
-		}
-		if dict.HasKey(durations, name) {
-			duration = fmt.Sprintf("%v", durations[name])
-		}
-		info[name] = Info{start, last, duration}
+	for _, h := range daemons.Values() {
+		info[h.name] = h.Info()
 	}
 	return info
 }
@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/roidaradal/fn/dict"
+)
+
+var errStopTimeout = errors.New("timeout waiting for daemon to stop")
+
+var daemons = dict.NewSyncMap[string, *Handle]()
+
+// Handle of a running daemon
+type Handle struct {
+	name     string
+	started  time.Time
+	task     Task
+	opts     Options
+	stats    runStats
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{} // closed when the daemon loop exits
+	wake     chan struct{} // signals the loop that the schedule or the failure streak changed
+	inFlight sync.WaitGroup
+	leader   *leader // nil if Options.Lease is not set
+
+	mu       sync.Mutex // guards schedule, paused, running, pending, stopped
+	schedule Schedule
+	paused   bool
+	running  int  // number of in-progress runs
+	pending  bool // a run is queued after the in-progress run
+	stopped  bool // loop has exited, no new runs are dispatched
+}
+
+// Daemon name
+func (h *Handle) Name() string {
+	return h.name
+}
+
+// Get the daemon info: schedule, run counts, stats, and recent runs
+func (h *Handle) Info() Info {
+	schedule := h.getSchedule()
+	info := Info{
+		Start:    h.started,
+		Schedule: schedule.String(),
+		Paused:   h.IsPaused(),
+	}
+	switch s := schedule.(type) {
+	case intervalSchedule:
+		info.Duration = time.Duration(s)
+	case alignedSchedule:
+		info.Duration = s.interval
+	}
+	h.stats.fill(&info)
+	if h.leader != nil {
+		info.IsLeader = h.leader.isLeader()
+	}
+	return info
+}
+
+// Closed when the daemon has stopped and its last run has finished
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Signals the daemon to stop: cancels the context of the in-flight runs
+// and stops scheduling new runs; does not wait
+func (h *Handle) Cancel() {
+	h.cancel()
+}
+
+// Signals the daemon to stop and waits for the in-flight runs to finish, up to timeout
+func (h *Handle) Stop(timeout time.Duration) error {
+	h.cancel()
+	return h.Wait(timeout)
+}
+
+// Waits for the daemon to stop, up to timeout (0 = no timeout)
+func (h *Handle) Wait(timeout time.Duration) error {
+	if timeout <= 0 {
+		<-h.done
+		return nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-h.done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: %s", errStopTimeout, h.name)
+	}
+}
+
+// Get the handle of running daemon
+func Get(name string) (*Handle, bool) {
+	return daemons.Get(name)
+}
+
+// Stops the daemon and waits for its in-flight runs to finish, up to timeout;
+// returns false if the daemon is not running
+func Stop(name string, timeout time.Duration) (bool, error) {
+	h, ok := daemons.Get(name)
+	if !ok {
+		return false, nil
+	}
+	return true, h.Stop(timeout)
+}
+
+// Signals all daemons to stop and waits for their in-flight runs to finish, up to timeout
+func StopAll(timeout time.Duration) error {
+	for _, h := range daemons.Values() {
+		h.Cancel()
+	}
+	return Wait(timeout)
+}
+
+// Waits for all daemons to stop, up to timeout (0 = no timeout)
+func Wait(timeout time.Duration) error {
+	handles := daemons.Values()
+	errs := make([]error, len(handles))
+	var wg sync.WaitGroup
+	for i, h := range handles {
+		wg.Go(func() {
+			errs[i] = h.Wait(timeout)
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Removes the stopped daemon from the registry
+func unregister(h *Handle) {
+	if current, ok := daemons.Get(h.name); ok && current == h {
+		daemons.Delete(h.name)
+	}
+}
@@ -0,0 +1,449 @@
+package daemon
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/rdb"
+	"github.com/roidaradal/rdb/ze"
+)
+
+var JobSchema *ze.Schema[Job]
+
+// Job status
+type JobStatus = string
+
+const (
+	JobPending JobStatus = "pending" // waiting for RunAt, or for retry
+	JobRunning JobStatus = "running" // claimed by a worker until LockedUntil
+	JobDone    JobStatus = "done"    // finished successfully
+	JobDead    JobStatus = "dead"    // failed MaxAttempts times, or cannot be handled
+)
+
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobNotDead  = errors.New("only dead jobs can be retried")
+	errLockExpired = errors.New("job lock expired: worker stopped or crashed")
+)
+
+// Queued one-off task: Payload is the JSON-encoded input of the Kind's handler
+type Job struct {
+	ID          ze.ID
+	Kind        string `col:"JobKind"`
+	Payload     string
+	Status      JobStatus
+	Attempts    uint
+	MaxAttempts uint
+	RunAt       ze.DateTime
+	LockedBy    string
+	LockedUntil *ze.DateTime // nil = not locked
+	LastError   string
+	CreatedAt   ze.DateTime
+	UpdatedAt   ze.DateTime
+}
+
+// Stores queued jobs shared by all app instances
+type JobStore interface {
+	// Add a new job, returns its ID
+	Add(job *Job) (ze.ID, error)
+	// Get job by ID
+	Get(id ze.ID) (*Job, error)
+	// Lock up to limit jobs of the given kinds for holder: pending jobs that are due,
+	// and running jobs whose lock expired (worker died); claimed jobs are set to running.
+	// Expired jobs use up an attempt, and are set to dead instead once they reach MaxAttempts
+	Claim(kinds []string, holder string, limit int, lockTTL time.Duration) ([]*Job, error)
+	// Extend the lock of running job until lockTTL from now, if still locked by holder;
+	// returns false if the lock was lost (expired and claimed by another worker)
+	Extend(id ze.ID, holder string, lockTTL time.Duration) (bool, error)
+	// Save the outcome of running job: Status, Attempts, RunAt, LastError, and clear the lock,
+	// if still locked by holder; returns false if the lock was lost
+	Finish(job *Job, holder string) (bool, error)
+	// Requeue dead job with reset attempts, to run as soon as possible
+	Retry(id ze.ID) error
+	// Get jobs with the given status, oldest RunAt first, up to limit
+	List(status JobStatus, limit int) ([]*Job, error)
+	// Get number of jobs per status
+	Counts() (map[JobStatus]int, error)
+}
+
+var (
+	_ JobStore = DBJobStore{}
+	_ JobStore = (*MemoryJobStore)(nil)
+)
+
+// JobStore backed by the daemon_jobs table
+type DBJobStore struct{}
+
+// Insert job
+func (DBJobStore) Add(job *Job) (ze.ID, error) {
+	rq, err := newJobRequest("daemon.AddJob")
+	if err != nil {
+		return 0, err
+	}
+	return JobSchema.InsertID(rq, job)
+}
+
+// Get job by ID
+func (DBJobStore) Get(id ze.ID) (*Job, error) {
+	rq, err := newJobRequest("daemon.GetJob")
+	if err != nil {
+		return nil, err
+	}
+	job := JobSchema.Ref
+	rows, err := JobSchema.GetRows(rq, rdb.Equal(&job.ID, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errJobNotFound
+	}
+	return rows[0], nil
+}
+
+// Select claimable jobs, then lock each one with a conditional update,
+// so jobs claimed by another instance in between are skipped; expired jobs that
+// reach MaxAttempts are set to dead with the same conditional update
+func (DBJobStore) Claim(kinds []string, holder string, limit int, lockTTL time.Duration) ([]*Job, error) {
+	rq, err := newJobRequest("daemon.ClaimJobs")
+	if err != nil {
+		return nil, err
+	}
+	now, lockedUntil := clock.DateTimeNowWithExpiry(lockTTL)
+	job := JobSchema.Ref
+	claimable := rdb.And(
+		rdb.In(&job.Kind, kinds),
+		rdb.Or(
+			rdb.And(rdb.Equal(&job.Status, JobPending), rdb.LessEqual(&job.RunAt, now)),
+			rdb.And(rdb.Equal(&job.Status, JobRunning), rdb.Or(
+				rdb.Equal(&job.LockedUntil, nil),
+				rdb.Less(&job.LockedUntil, &now),
+			)),
+		),
+	)
+	q := rdb.NewFullSelectRowsQuery(JobSchema.Table, JobSchema.Reader)
+	q.Where(claimable)
+	q.OrderAsc(rdb.Column(&job.RunAt))
+	q.Limit(uint(limit))
+	candidates, err := q.Query(rq.DB)
+	if err != nil {
+		rq.AddLog("Failed to load jobs")
+		return nil, err
+	}
+	claimed := make([]*Job, 0, len(candidates))
+	for _, candidate := range candidates {
+		item := *candidate
+		item.lock(holder, &lockedUntil)
+		uq := rdb.NewUpdateQuery[Job](JobSchema.Table)
+		rdb.Update(uq, &job.Status, item.Status)
+		rdb.Update(uq, &job.Attempts, item.Attempts)
+		rdb.Update(uq, &job.LockedBy, item.LockedBy)
+		rdb.Update(uq, &job.LockedUntil, item.LockedUntil)
+		rdb.Update(uq, &job.LastError, item.LastError)
+		rdb.Update(uq, &job.UpdatedAt, now)
+		uq.Where(rdb.And(rdb.Equal(&job.ID, candidate.ID), claimable))
+		result, err := rdb.Exec(uq, rq.DB)
+		if err != nil {
+			return claimed, err
+		}
+		if rdb.RowsAffected(result) != 1 {
+			continue // claimed by another instance
+		}
+		if item.Status == JobDead {
+			logExpiredDead(&item)
+			continue
+		}
+		claimed = append(claimed, &item)
+	}
+	return claimed, nil
+}
+
+// Extend lock with a conditional update on the holder
+func (s DBJobStore) Extend(id ze.ID, holder string, lockTTL time.Duration) (bool, error) {
+	rq, err := newJobRequest("daemon.ExtendJob")
+	if err != nil {
+		return false, err
+	}
+	now, lockedUntil := clock.DateTimeNowWithExpiry(lockTTL)
+	job := JobSchema.Ref
+	q := rdb.NewUpdateQuery[Job](JobSchema.Table)
+	rdb.Update(q, &job.LockedUntil, &lockedUntil)
+	rdb.Update(q, &job.UpdatedAt, now)
+	q.Where(lockedBy(id, holder))
+	result, err := rdb.Exec(q, rq.DB)
+	if err != nil {
+		return false, err
+	}
+	if rdb.RowsAffected(result) == 1 {
+		return true, nil
+	}
+	// No update: lock is lost, or was extended within the same second
+	item, err := s.Get(id)
+	if err != nil {
+		return false, err
+	}
+	return item.Status == JobRunning && item.LockedBy == holder, nil
+}
+
+// Save job outcome with a conditional update on the holder
+func (DBJobStore) Finish(item *Job, holder string) (bool, error) {
+	rq, err := newJobRequest("daemon.FinishJob")
+	if err != nil {
+		return false, err
+	}
+	job := JobSchema.Ref
+	q := rdb.NewUpdateQuery[Job](JobSchema.Table)
+	rdb.Update(q, &job.Status, item.Status)
+	rdb.Update(q, &job.Attempts, item.Attempts)
+	rdb.Update(q, &job.RunAt, item.RunAt)
+	rdb.Update(q, &job.LockedBy, "")
+	rdb.Update(q, &job.LockedUntil, nil)
+	rdb.Update(q, &job.LastError, item.LastError)
+	rdb.Update(q, &job.UpdatedAt, clock.DateTimeNow())
+	q.Where(lockedBy(item.ID, holder))
+	result, err := rdb.Exec(q, rq.DB)
+	if err != nil {
+		return false, err
+	}
+	return rdb.RowsAffected(result) == 1, nil // Status always changes from running
+}
+
+// Requeue dead job with a conditional update on its status
+func (s DBJobStore) Retry(id ze.ID) error {
+	rq, err := newJobRequest("daemon.RetryJob")
+	if err != nil {
+		return err
+	}
+	job := JobSchema.Ref
+	now := clock.DateTimeNow()
+	q := rdb.NewUpdateQuery[Job](JobSchema.Table)
+	rdb.Update(q, &job.Status, JobPending)
+	rdb.Update(q, &job.Attempts, 0)
+	rdb.Update(q, &job.RunAt, now)
+	rdb.Update(q, &job.UpdatedAt, now)
+	q.Where(rdb.And(rdb.Equal(&job.ID, id), rdb.Equal(&job.Status, JobDead)))
+	result, err := rdb.Exec(q, rq.DB)
+	if err != nil {
+		return err
+	}
+	if rdb.RowsAffected(result) == 1 {
+		return nil
+	}
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return errJobNotDead
+}
+
+// Get jobs with status, oldest RunAt first
+func (DBJobStore) List(status JobStatus, limit int) ([]*Job, error) {
+	rq, err := newJobRequest("daemon.ListJobs")
+	if err != nil {
+		return nil, err
+	}
+	job := JobSchema.Ref
+	q := rdb.NewFullSelectRowsQuery(JobSchema.Table, JobSchema.Reader)
+	q.Where(rdb.Equal(&job.Status, status))
+	q.OrderAsc(rdb.Column(&job.RunAt))
+	q.Limit(uint(limit))
+	return q.Query(rq.DB)
+}
+
+// Count jobs per status
+func (DBJobStore) Counts() (map[JobStatus]int, error) {
+	rq, err := newJobRequest("daemon.CountJobs")
+	if err != nil {
+		return nil, err
+	}
+	job := JobSchema.Ref
+	counts := make(map[JobStatus]int)
+	for _, status := range []JobStatus{JobPending, JobRunning, JobDone, JobDead} {
+		count, err := JobSchema.Count(rq, rdb.Equal(&job.Status, status))
+		if err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, nil
+}
+
+// In-memory JobStore with the same semantics as DBJobStore:
+// a stand-in for tests and single-process setups; jobs do not survive restarts
+type MemoryJobStore struct {
+	mu     sync.Mutex
+	lastID ze.ID
+	jobs   map[ze.ID]*Job
+}
+
+// Create new MemoryJobStore
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[ze.ID]*Job)}
+}
+
+// Add job with the next ID
+func (s *MemoryJobStore) Add(job *Job) (ze.ID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID += 1
+	item := *job
+	item.ID = s.lastID
+	s.jobs[item.ID] = &item
+	return item.ID, nil
+}
+
+// Get copy of job
+func (s *MemoryJobStore) Get(id ze.ID) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	item := *job
+	return &item, nil
+}
+
+// Lock due pending jobs and expired running jobs
+func (s *MemoryJobStore) Claim(kinds []string, holder string, limit int, lockTTL time.Duration) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now, lockedUntil := clock.DateTimeNowWithExpiry(lockTTL)
+	candidates := make([]*Job, 0)
+	for _, job := range s.jobs {
+		if !slices.Contains(kinds, job.Kind) {
+			continue
+		}
+		isDue := job.Status == JobPending && job.RunAt <= now
+		isStale := job.Status == JobRunning && (job.LockedUntil == nil || *job.LockedUntil < now)
+		if isDue || isStale {
+			candidates = append(candidates, job)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b *Job) int {
+		return cmp.Or(cmp.Compare(a.RunAt, b.RunAt), cmp.Compare(a.ID, b.ID))
+	})
+	claimed := make([]*Job, 0, limit)
+	for _, job := range candidates[:min(limit, len(candidates))] {
+		job.lock(holder, &lockedUntil)
+		job.UpdatedAt = now
+		if job.Status == JobDead {
+			logExpiredDead(job)
+			continue
+		}
+		item := *job
+		claimed = append(claimed, &item)
+	}
+	return claimed, nil
+}
+
+// Extend lock if still locked by holder
+func (s *MemoryJobStore) Extend(id ze.ID, holder string, lockTTL time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != JobRunning || job.LockedBy != holder {
+		return false, nil
+	}
+	now, lockedUntil := clock.DateTimeNowWithExpiry(lockTTL)
+	job.UpdatedAt, job.LockedUntil = now, &lockedUntil
+	return true, nil
+}
+
+// Save job outcome if still locked by holder
+func (s *MemoryJobStore) Finish(item *Job, holder string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[item.ID]
+	if !ok || job.Status != JobRunning || job.LockedBy != holder {
+		return false, nil
+	}
+	job.Status, job.Attempts, job.RunAt, job.LastError = item.Status, item.Attempts, item.RunAt, item.LastError
+	job.LockedBy, job.LockedUntil = "", nil
+	job.UpdatedAt = clock.DateTimeNow()
+	return true, nil
+}
+
+// Requeue dead job
+func (s *MemoryJobStore) Retry(id ze.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return errJobNotFound
+	}
+	if job.Status != JobDead {
+		return errJobNotDead
+	}
+	now := clock.DateTimeNow()
+	job.Status, job.Attempts, job.RunAt, job.UpdatedAt = JobPending, 0, now, now
+	return nil
+}
+
+// Get copies of jobs with status, oldest RunAt first
+func (s *MemoryJobStore) List(status JobStatus, limit int) ([]*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]*Job, 0)
+	for _, job := range s.jobs {
+		if job.Status == status {
+			item := *job
+			jobs = append(jobs, &item)
+		}
+	}
+	slices.SortFunc(jobs, func(a, b *Job) int {
+		return cmp.Or(cmp.Compare(a.RunAt, b.RunAt), cmp.Compare(a.ID, b.ID))
+	})
+	return jobs[:min(limit, len(jobs))], nil
+}
+
+// Count jobs per status
+func (s *MemoryJobStore) Counts() (map[JobStatus]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := map[JobStatus]int{JobPending: 0, JobRunning: 0, JobDone: 0, JobDead: 0}
+	for _, job := range s.jobs {
+		counts[job.Status] += 1
+	}
+	return counts, nil
+}
+
+// Lock claimable job for holder; an expired running job uses up the attempt
+// of the run that never finished, and is set to dead if it reaches MaxAttempts
+func (job *Job) lock(holder string, lockedUntil *ze.DateTime) {
+	if job.Status == JobRunning {
+		job.Attempts += 1
+		job.LastError = errLockExpired.Error()
+		if job.Attempts >= job.MaxAttempts {
+			job.Status, job.LockedBy, job.LockedUntil = JobDead, "", nil
+			return
+		}
+	}
+	job.Status, job.LockedBy, job.LockedUntil = JobRunning, holder, lockedUntil
+}
+
+// Log expired job that was set to dead when reclaimed
+func logExpiredDead(job *Job) {
+	fmt.Printf("Job:%d %s is dead after %d attempts: %v\n", job.ID, job.Kind, job.Attempts, errLockExpired)
+}
+
+// Condition: running job locked by holder
+func lockedBy(id ze.ID, holder string) rdb.Condition {
+	job := JobSchema.Ref
+	return rdb.And(
+		rdb.Equal(&job.ID, id),
+		rdb.Equal(&job.Status, JobRunning),
+		rdb.Equal(&job.LockedBy, holder),
+	)
+}
+
+// Create request for DBJobStore
+func newJobRequest(name string) (*ze.Request, error) {
+	if JobSchema == nil {
+		return nil, ze.ErrMissingSchema
+	}
+	return ze.NewRequest(name)
+}
@@ -0,0 +1,292 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/rdb"
+	"github.com/roidaradal/rdb/ze"
+)
+
+const defaultLeaseTTL = time.Minute
+
+var LeaseSchema *ze.Schema[Lease]
+
+// Daemon lease: only the Holder runs the daemon until ExpiresAt
+type Lease struct {
+	Name      string `col:"DaemonName"`
+	Holder    string
+	ExpiresAt ze.DateTime
+}
+
+// Stores daemon leases shared by all app instances
+type LeaseStore interface {
+	// Acquire or renew the lease of daemon for holder until ttl from now;
+	// returns false if another holder has an unexpired lease
+	Acquire(name, holder string, ttl time.Duration) (bool, error)
+	// Release the lease of daemon if held by holder
+	Release(name, holder string) error
+}
+
+var (
+	_ LeaseStore = DBLeaseStore{}
+	_ LeaseStore = (*MemoryLeaseStore)(nil)
+)
+
+var (
+	instanceMu sync.RWMutex
+	instanceID = defaultInstanceID()
+)
+
+// Set the ID of this app instance, used as lease holder
+func SetInstanceID(id string) {
+	instanceMu.Lock()
+	defer instanceMu.Unlock()
+	instanceID = id
+}
+
+// Get the ID of this app instance, default: <hostname>:<pid>:<random>
+func InstanceID() string {
+	instanceMu.RLock()
+	defer instanceMu.RUnlock()
+	return instanceID
+}
+
+// LeaseStore backed by the daemon_leases table
+type DBLeaseStore struct{}
+
+// Acquire or renew lease: takes over if the lease is free, expired, or already held by holder
+func (DBLeaseStore) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	if LeaseSchema == nil {
+		return false, ze.ErrMissingSchema
+	}
+	rq, err := ze.NewRequest("daemon.Lease: %s", name)
+	if err != nil {
+		return false, err
+	}
+	now, expiry := clock.DateTimeNowWithExpiry(ttl)
+	lease := LeaseSchema.Ref
+	q := rdb.NewUpdateQuery[Lease](LeaseSchema.Table)
+	rdb.Update(q, &lease.Holder, holder)
+	rdb.Update(q, &lease.ExpiresAt, expiry)
+	q.Where(rdb.And(
+		rdb.Equal(&lease.Name, name),
+		rdb.Or(rdb.Equal(&lease.Holder, holder), rdb.Less(&lease.ExpiresAt, now)),
+	))
+	result, err := rdb.Exec(q, rq.DB)
+	if err != nil {
+		return false, err
+	}
+	if rdb.RowsAffected(result) == 1 {
+		return true, nil
+	}
+
+	// No update: lease is held by another, does not exist yet, or was renewed within the same second
+	rows, err := LeaseSchema.GetRows(rq, rdb.Equal(&lease.Name, name))
+	if err != nil {
+		return false, err
+	}
+	if len(rows) > 0 {
+		return rows[0].Holder == holder, nil
+	}
+	err = LeaseSchema.Insert(rq, &Lease{Name: name, Holder: holder, ExpiresAt: expiry})
+	if err == nil {
+		return true, nil
+	}
+	// Insert fails if another instance created the lease first, or the table is unusable
+	rows, readErr := LeaseSchema.GetRows(rq, rdb.Equal(&lease.Name, name))
+	if readErr != nil || len(rows) == 0 {
+		return false, err
+	}
+	return rows[0].Holder == holder, nil
+}
+
+// Release lease by expiring it now, if held by holder
+func (DBLeaseStore) Release(name, holder string) error {
+	if LeaseSchema == nil {
+		return ze.ErrMissingSchema
+	}
+	rq, err := ze.NewRequest("daemon.Release: %s", name)
+	if err != nil {
+		return err
+	}
+	lease := LeaseSchema.Ref
+	updates := rdb.FieldUpdates{
+		rdb.Field(LeaseSchema.Name, &lease.ExpiresAt): {nil, clock.DateTimeNow()},
+	}
+	condition := rdb.And(rdb.Equal(&lease.Name, name), rdb.Equal(&lease.Holder, holder))
+	return LeaseSchema.Update(rq, updates, condition)
+}
+
+// In-memory LeaseStore with the same semantics as DBLeaseStore:
+// a stand-in for tests and single-process setups, shared by the handles that use it
+type MemoryLeaseStore struct {
+	mu     sync.Mutex
+	leases map[string]memoryLease
+}
+
+type memoryLease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+// Create new MemoryLeaseStore
+func NewMemoryLeaseStore() *MemoryLeaseStore {
+	return &MemoryLeaseStore{leases: make(map[string]memoryLease)}
+}
+
+// Acquire or renew lease: takes over if the lease is free, expired, or already held by holder
+func (s *MemoryLeaseStore) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := clock.Now()
+	lease, ok := s.leases[name]
+	if ok && lease.holder != holder && now.Before(lease.expiresAt) {
+		return false, nil
+	}
+	s.leases[name] = memoryLease{holder: holder, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+// Release lease if held by holder
+func (s *MemoryLeaseStore) Release(name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lease, ok := s.leases[name]; ok && lease.holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+// Holds the daemon lease for one holder: a heartbeat acquires or renews the lease
+// every TTL/3, between runs as well as during runs, so only one instance runs the daemon
+type leader struct {
+	store  LeaseStore
+	name   string
+	holder string
+	ttl    time.Duration
+	cancel context.CancelFunc // stops the heartbeat
+	done   chan struct{}      // closed when the heartbeat has stopped and released the lease
+
+	mu         sync.Mutex // guards validUntil, termCtx, termCancel
+	validUntil time.Time  // lease is held until then, zero if not held
+	termCtx    context.Context
+	termCancel context.CancelFunc // ends the current term when the lease is lost
+}
+
+// Create leader of daemon lease for holder
+func newLeader(store LeaseStore, name, holder string, ttl time.Duration) *leader {
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+	termCtx, termCancel := context.WithCancel(context.Background())
+	termCancel() // not leader yet
+	return &leader{
+		store:      store,
+		name:       name,
+		holder:     holder,
+		ttl:        ttl,
+		done:       make(chan struct{}),
+		termCtx:    termCtx,
+		termCancel: termCancel,
+	}
+}
+
+// Acquires the lease now, then starts the heartbeat
+func (l *leader) start() {
+	l.renew()
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go l.heartbeat(ctx)
+}
+
+// Stops the heartbeat and releases the lease so another instance can take over immediately
+func (l *leader) stop() {
+	l.cancel()
+	<-l.done
+}
+
+// Renews or acquires the lease every TTL/3 until ctx is cancelled, then releases it
+func (l *leader) heartbeat(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.release()
+			return
+		case <-ticker.C:
+			l.renew()
+		}
+	}
+}
+
+// Acquires or renews the lease; starts a new term if acquired, ends the term if lost
+func (l *leader) renew() {
+	now := clock.Now()
+	ok, err := l.store.Acquire(l.name, l.holder, l.ttl)
+	if err != nil {
+		fmt.Printf("Daemon:%s failed to acquire lease: %v\n", l.name, err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	wasLeader := l.termCtx.Err() == nil
+	switch {
+	case ok:
+		l.validUntil = now.Add(l.ttl)
+		if !wasLeader {
+			l.termCtx, l.termCancel = context.WithCancel(context.Background())
+		}
+	case err != nil && now.Before(l.validUntil):
+		// keep the current term until the lease expires, the store may recover
+	default:
+		if wasLeader {
+			fmt.Printf("Daemon:%s lost lease\n", l.name)
+		}
+		l.validUntil = time.Time{}
+		l.termCancel()
+	}
+}
+
+// End the term and release the lease if held
+func (l *leader) release() {
+	l.mu.Lock()
+	l.validUntil = time.Time{}
+	l.termCancel()
+	l.mu.Unlock()
+	err := l.store.Release(l.name, l.holder)
+	if err != nil {
+		fmt.Printf("Daemon:%s failed to release lease: %v\n", l.name, err)
+	}
+}
+
+// Get the context of the current term, cancelled when the lease is lost or released;
+// returns a cancelled context if the lease is not held or has expired
+func (l *leader) term() context.Context {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.termCtx.Err() == nil && !clock.Now().Before(l.validUntil) {
+		l.termCancel() // heartbeat is late: lease may already be taken over
+	}
+	return l.termCtx
+}
+
+// Check if the lease is held and not expired
+func (l *leader) isLeader() bool {
+	return l.term().Err() == nil
+}
+
+// Default instance ID: <hostname>:<pid>:<random>
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return fmt.Sprintf("%s:%d:%04x", hostname, os.Getpid(), rand.IntN(0x10000))
+}
@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testLeaseTTL = 90 * time.Millisecond
+
+func TestLeaderHoldsLeaseBetweenRuns(t *testing.T) {
+	store := NewMemoryLeaseStore()
+	a := newLeader(store, "cleanup", "a", testLeaseTTL)
+	b := newLeader(store, "cleanup", "b", testLeaseTTL)
+	a.start()
+	b.start()
+	defer b.stop()
+
+	// The holder keeps renewing for several TTLs, so the other holder never takes over
+	for range 4 {
+		time.Sleep(testLeaseTTL)
+		if !a.isLeader() {
+			t.Fatal("a lost the lease while renewing")
+		}
+		if b.isLeader() {
+			t.Fatal("b is leader while a's lease is valid")
+		}
+	}
+
+	// Releasing lets the other holder take over on its next heartbeat
+	a.stop()
+	if a.isLeader() {
+		t.Fatal("a is leader after stop")
+	}
+	waitFor(t, testLeaseTTL, b.isLeader)
+}
+
+func TestLeaderTakesOverExpiredLease(t *testing.T) {
+	store := NewMemoryLeaseStore()
+	failing := &failingLeaseStore{LeaseStore: store}
+	a := newLeader(failing, "cleanup", "a", testLeaseTTL)
+	b := newLeader(store, "cleanup", "b", testLeaseTTL)
+	a.start()
+	defer a.stop()
+	b.start()
+	defer b.stop()
+	if !a.isLeader() || b.isLeader() {
+		t.Fatal("a should hold the lease")
+	}
+	term := a.term()
+
+	// a cannot renew: it steps down when its lease expires, and b takes over
+	failing.fail.Store(true)
+	waitFor(t, 2*testLeaseTTL, func() bool { return !a.isLeader() })
+	if term.Err() == nil {
+		t.Fatal("a's term is not cancelled after its lease expired")
+	}
+	waitFor(t, 2*testLeaseTTL, b.isLeader)
+}
+
+func TestHandleSkipsRunsWithoutLease(t *testing.T) {
+	store := NewMemoryLeaseStore()
+	other := newLeader(store, "lease-test", "other", testLeaseTTL)
+	other.start()
+
+	var runs atomic.Int32
+	h := RunTask("lease-test", func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}, 20, time.Millisecond, &Options{Lease: store, LeaseTTL: testLeaseTTL})
+	defer h.Stop(time.Second)
+
+	time.Sleep(3 * testLeaseTTL)
+	if n := runs.Load(); n != 0 {
+		t.Fatalf("ran %d times while another instance holds the lease", n)
+	}
+	if h.Info().IsLeader {
+		t.Fatal("IsLeader is true while another instance holds the lease")
+	}
+
+	other.stop()
+	waitFor(t, 2*testLeaseTTL, func() bool { return runs.Load() > 0 })
+	if !h.Info().IsLeader {
+		t.Fatal("IsLeader is false after taking over the lease")
+	}
+}
+
+// LeaseStore whose Acquire fails while fail is set
+type failingLeaseStore struct {
+	LeaseStore
+	fail atomic.Bool
+}
+
+func (s *failingLeaseStore) Acquire(name, holder string, ttl time.Duration) (bool, error) {
+	if s.fail.Load() {
+		return false, errors.New("store unavailable")
+	}
+	return s.LeaseStore.Acquire(name, holder, ttl)
+}
+
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %v", timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
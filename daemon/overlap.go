@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/roidaradal/fn/clock"
+)
+
+var errRunTimeout = errors.New("daemon run timed out")
+
+// What to do when a run is due while the previous run is still in progress
+type Overlap string
+
+const (
+	OverlapQueue      Overlap = "queue"      // run once more after the in-progress run (default)
+	OverlapSkip       Overlap = "skip"       // skip the due run
+	OverlapConcurrent Overlap = "concurrent" // start the due run alongside the in-progress run
+)
+
+// Starts a run following the overlap policy;
+// returns false if the daemon is stopped or stopping
+func (h *Handle) dispatch() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped || h.ctx.Err() != nil {
+		return false
+	}
+	switch {
+	case h.running == 0 || h.opts.Overlap == OverlapConcurrent:
+		h.running += 1
+		h.inFlight.Add(1)
+		go h.execute()
+	case h.opts.Overlap == OverlapSkip:
+		h.stats.skip()
+		fmt.Printf("Daemon:%s skipped run, previous run in progress\n", h.name)
+	default:
+		h.pending = true // at most one queued run
+	}
+	return true
+}
+
+// Stop dispatching runs, so that no run starts while waiting for the in-flight runs
+func (h *Handle) markStopped() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+}
+
+// Runs the task, then the queued run if any
+func (h *Handle) execute() {
+	defer h.inFlight.Done()
+	for {
+		h.runTask(h.task)
+		h.mu.Lock()
+		if h.pending && h.ctx.Err() == nil {
+			h.pending = false
+			h.mu.Unlock()
+			continue
+		}
+		h.running -= 1
+		h.mu.Unlock()
+		return
+	}
+}
+
+// Runs the task with the per-run timeout and records the result;
+// skips the run if another instance holds the daemon lease, cancels it if the lease is lost
+func (h *Handle) runTask(task Task) {
+	term := context.Background()
+	if h.leader != nil {
+		term = h.leader.term()
+		if term.Err() != nil {
+			return // another instance runs the daemon
+		}
+	}
+	start := clock.Now()
+	h.stats.setLastRun(start)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if h.opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(h.ctx, h.opts.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(h.ctx)
+	}
+	stopLost := context.AfterFunc(term, cancel)
+	defer stopLost()
+	err := runOnce(ctx, task)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %v", errRunTimeout, h.opts.Timeout)
+	}
+	cancel()
+	failures, streakChanged := h.stats.record(newRunRecord(start, clock.Now(), err))
+	if streakChanged && h.opts.MaxBackoff > 0 {
+		h.reschedule() // the next run was scheduled before this run's outcome was known
+	}
+	if err != nil {
+		fmt.Printf("Daemon:%s failed (%d): %v\n", h.name, failures, err)
+	}
+}
@@ -0,0 +1,332 @@
+package daemon
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/fn/ds"
+	"github.com/roidaradal/krap/root"
+	"github.com/roidaradal/krap/sys"
+	"github.com/roidaradal/rdb/ze"
+)
+
+const (
+	defaultMaxAttempts  uint = 5
+	defaultConcurrency  int  = 1
+	defaultPollInterval      = 5 * time.Second
+	defaultLockTTL           = 5 * time.Minute
+	defaultRetryBackoff      = 30 * time.Second
+	defaultMaxRetryWait      = time.Hour
+	jobListLimit        int  = 100
+)
+
+var (
+	errNoJobHandler = errors.New("no handler for job kind")
+	errQueueStopped = errors.New("job queue is not running")
+	errNoRetry      = errors.New("job cannot be retried")
+)
+
+// Handles the JSON-encoded job payload
+type jobHandler = func(ctx context.Context, payload string) error
+
+var jobHandlers = dict.NewSyncMap[string, jobHandler]()
+
+// Options for Enqueue, nil = defaults
+type JobOptions struct {
+	Delay       time.Duration // run after Delay, 0 = as soon as possible
+	MaxAttempts uint          // 0 = 5
+}
+
+// Job queue worker config, nil = defaults
+type QueueConfig struct {
+	Store        JobStore      // nil = DBJobStore
+	Concurrency  int           // max jobs running at once in this instance, 0 = 1
+	PollInterval time.Duration // 0 = 5s
+	LockTTL      time.Duration // job lock, renewed every LockTTL/3 while the job runs; 0 = 5m
+	JobTimeout   time.Duration // if > 0, cancels the job's context after JobTimeout
+	RetryBackoff time.Duration // wait before first retry, doubles per attempt, 0 = 30s
+	MaxRetryWait time.Duration // cap on the retry wait, 0 = 1h
+}
+
+// Job queue status
+type QueueInfo struct {
+	Counts      map[JobStatus]int
+	Concurrency int
+	Active      int // jobs running in this instance
+	Kinds       []string
+}
+
+// Job queue worker
+type queue struct {
+	cfg    QueueConfig
+	active atomic.Int32
+	claims atomic.Uint64 // claim count, makes lock holders unique per claim
+	freed  chan struct{} // signals that a running job finished
+}
+
+var (
+	queueMu      sync.RWMutex
+	currentQueue *queue
+)
+
+// Register the handler of job kind; payloads are JSON-decoded into T
+func HandleJob[T any](kind string, handler func(ctx context.Context, payload *T) error) {
+	jobHandlers.Set(kind, func(ctx context.Context, text string) error {
+		payload := new(T)
+		if err := json.Unmarshal([]byte(text), payload); err != nil {
+			return fmt.Errorf("%w: invalid payload: %w", errNoRetry, err)
+		}
+		return handler(ctx, payload)
+	})
+}
+
+// Add job of kind with JSON-encoded payload to the queue, returns the job ID;
+// uses the running queue's store, or DBJobStore if the queue is not started
+func Enqueue[T any](kind string, payload *T, opts *JobOptions) (ze.ID, error) {
+	if opts == nil {
+		opts = &JobOptions{}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	now := clock.Now()
+	job := &Job{
+		Kind:        kind,
+		Payload:     string(data),
+		Status:      JobPending,
+		MaxAttempts: maxAttempts,
+		RunAt:       clock.StandardFormat(now.Add(opts.Delay)),
+		CreatedAt:   clock.StandardFormat(now),
+		UpdatedAt:   clock.StandardFormat(now),
+	}
+	return jobStore().Add(job)
+}
+
+// Starts the job queue worker as daemon <name>; jobs of all registered kinds are claimed
+// every PollInterval, up to Concurrency at a time. Returns the daemon handle
+func StartQueue(name string, cfg *QueueConfig) *Handle {
+	q := &queue{freed: make(chan struct{}, 1)}
+	if cfg != nil {
+		q.cfg = *cfg
+	}
+	q.cfg.Store = cmp.Or(q.cfg.Store, JobStore(DBJobStore{}))
+	q.cfg.Concurrency = cmp.Or(q.cfg.Concurrency, defaultConcurrency)
+	q.cfg.PollInterval = cmp.Or(q.cfg.PollInterval, defaultPollInterval)
+	q.cfg.LockTTL = cmp.Or(q.cfg.LockTTL, defaultLockTTL)
+	q.cfg.RetryBackoff = cmp.Or(q.cfg.RetryBackoff, defaultRetryBackoff)
+	q.cfg.MaxRetryWait = cmp.Or(q.cfg.MaxRetryWait, defaultMaxRetryWait)
+
+	queueMu.Lock()
+	currentQueue = q
+	queueMu.Unlock()
+	return start(name, intervalSchedule(q.cfg.PollInterval), q.work, nil) // work polls while jobs run
+}
+
+// Get the job queue status
+func JobQueueInfo() (*QueueInfo, error) {
+	q := getQueue()
+	if q == nil {
+		return nil, errQueueStopped
+	}
+	counts, err := q.cfg.Store.Counts()
+	if err != nil {
+		return nil, err
+	}
+	kinds := jobHandlers.Keys()
+	slices.Sort(kinds)
+	return &QueueInfo{
+		Counts:      counts,
+		Concurrency: q.cfg.Concurrency,
+		Active:      int(q.active.Load()),
+		Kinds:       kinds,
+	}, nil
+}
+
+// Get up to 100 jobs with the given status
+func ListJobs(status JobStatus) ([]*Job, error) {
+	return jobStore().List(status, jobListLimit)
+}
+
+// Requeue dead job with reset attempts, to run as soon as possible
+func RetryJob(id ze.ID) error {
+	return jobStore().Retry(id)
+}
+
+// Root commands: jobs/info, jobs/list, jobs/retry
+func QueueCommands() []*root.CmdConfig {
+	return []*root.CmdConfig{
+		root.NewCommand("jobs/info", 0, "Show job queue status", func([]string) {
+			info, err := JobQueueInfo()
+			sys.DisplayData(info, nil, err)
+		}),
+		root.NewCommand("jobs/list", 0, "[STATUS=dead] List jobs with status: pending, running, done, dead", func(params []string) {
+			status := JobDead
+			if len(params) > 0 {
+				status = params[0]
+			}
+			jobs, err := ListJobs(status)
+			sys.DisplayList(ds.NewList(jobs), nil, err)
+		}),
+		root.NewCommand("jobs/retry", 1, "<ID> Requeue dead job", func(params []string) {
+			id, err := strconv.ParseUint(params[0], 10, 0)
+			if err == nil {
+				err = RetryJob(ze.ID(id))
+			}
+			sys.DisplayOutput(nil, err)
+		}),
+	}
+}
+
+// Queue daemon task: claims and runs jobs while there are free workers and due jobs,
+// polling every PollInterval while jobs are running; returns when the queue is drained
+// and all claimed jobs have finished
+func (q *queue) work(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	poll := time.NewTicker(q.cfg.PollInterval)
+	defer poll.Stop()
+	kinds := jobHandlers.Keys()
+	for ctx.Err() == nil {
+		free := q.cfg.Concurrency - int(q.active.Load())
+		if free > 0 && len(kinds) > 0 {
+			holder := fmt.Sprintf("%s#%d", InstanceID(), q.claims.Add(1))
+			jobs, err := q.cfg.Store.Claim(kinds, holder, free, q.cfg.LockTTL)
+			if err != nil {
+				return err
+			}
+			for _, job := range jobs {
+				q.active.Add(1)
+				wg.Go(func() {
+					q.runJob(ctx, job)
+					q.active.Add(-1)
+					select {
+					case q.freed <- struct{}{}:
+					default:
+					}
+				})
+			}
+			if len(jobs) > 0 && len(jobs) == free {
+				continue // may have more due jobs
+			}
+		}
+		if q.active.Load() == 0 {
+			return nil
+		}
+		select {
+		case <-q.freed:
+		case <-poll.C: // claim new due jobs while long jobs are running
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+// Runs the job handler while extending its lock, and saves the outcome:
+// done, retry with backoff, or dead; the outcome is discarded if the lock was lost
+func (q *queue) runJob(ctx context.Context, job *Job) {
+	holder := job.LockedBy
+	handler, ok := jobHandlers.Get(job.Kind)
+	var err error
+	if !ok {
+		err = fmt.Errorf("%w: %w %s", errNoRetry, errNoJobHandler, job.Kind)
+	} else {
+		var jobCtx context.Context
+		var cancel context.CancelFunc
+		if q.cfg.JobTimeout > 0 {
+			jobCtx, cancel = context.WithTimeout(ctx, q.cfg.JobTimeout)
+		} else {
+			jobCtx, cancel = context.WithCancel(ctx)
+		}
+		done := make(chan struct{})
+		go q.extendLock(job, holder, done, cancel)
+		err = runOnce(jobCtx, func(ctx context.Context) error {
+			return handler(ctx, job.Payload)
+		})
+		close(done)
+		cancel()
+	}
+	switch {
+	case err == nil:
+		job.Status, job.LastError = JobDone, ""
+		job.Attempts += 1
+	case ctx.Err() != nil:
+		job.Status = JobPending // worker stopped: requeue without using up an attempt
+	default:
+		job.Attempts += 1
+		job.LastError = err.Error()
+		if job.Attempts >= job.MaxAttempts || errors.Is(err, errNoRetry) {
+			job.Status = JobDead
+			fmt.Printf("Job:%d %s is dead after %d attempts: %v\n", job.ID, job.Kind, job.Attempts, err)
+		} else {
+			job.Status = JobPending
+			job.RunAt = clock.StandardFormat(clock.Now().Add(q.retryWait(job.Attempts)))
+		}
+	}
+	saved, err := q.cfg.Store.Finish(job, holder)
+	if err != nil {
+		fmt.Printf("Job:%d %s failed to save: %v\n", job.ID, job.Kind, err)
+	} else if !saved {
+		fmt.Printf("Job:%d %s lost its lock, outcome discarded\n", job.ID, job.Kind)
+	}
+}
+
+// Extends the job lock every LockTTL/3 until done is closed;
+// calls lost if the lock was claimed by another worker
+func (q *queue) extendLock(job *Job, holder string, done <-chan struct{}, lost func()) {
+	ticker := time.NewTicker(q.cfg.LockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ok, err := q.cfg.Store.Extend(job.ID, holder, q.cfg.LockTTL)
+			if err != nil {
+				fmt.Printf("Job:%d %s failed to extend lock: %v\n", job.ID, job.Kind, err)
+			} else if !ok {
+				fmt.Printf("Job:%d %s lost its lock, cancelling\n", job.ID, job.Kind)
+				lost()
+				return
+			}
+		}
+	}
+}
+
+// Get the wait before retry: RetryBackoff * 2^(attempts-1), up to MaxRetryWait
+func (q *queue) retryWait(attempts uint) time.Duration {
+	wait := q.cfg.RetryBackoff << min(attempts-1, maxBackoffShift)
+	if wait <= 0 || wait > q.cfg.MaxRetryWait {
+		wait = q.cfg.MaxRetryWait
+	}
+	return wait
+}
+
+// Get the running queue
+func getQueue() *queue {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	return currentQueue
+}
+
+// Get the running queue's store, or DBJobStore
+func jobStore() JobStore {
+	if q := getQueue(); q != nil {
+		return q.cfg.Store
+	}
+	return DBJobStore{}
+}
@@ -0,0 +1,217 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const reloadStopTimeout = 30 * time.Second // wait for the last run of daemons disabled on reload
+
+// Daemon bound to a config key, restarted or rescheduled when its Spec changes
+type binding struct {
+	name      string
+	task      Task
+	timeScale time.Duration
+	opts      *Options
+	spec      Spec
+}
+
+var (
+	bindingsMu sync.Mutex
+	bindings   = make(map[string]*binding) // <Domain>.<Key> => binding
+)
+
+// Runs a task following the Spec of config key <Domain>.<Key>, like RunSpec,
+// and binds the daemon to the key so that ApplySpecs, WatchConfig,
+// and konfig.WatchDaemons can apply config changes without a restart.
+// Returns the daemon handle (nil if disabled), or an error if the Spec is invalid
+func RunConfigured(key, name string, task Task, spec Spec, timeScale time.Duration, opts *Options) (*Handle, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid daemon %s: %w", key, err)
+	}
+	bindingsMu.Lock()
+	defer bindingsMu.Unlock()
+	bindings[key] = &binding{name, task, timeScale, opts, spec}
+	return RunSpec(name, task, spec, timeScale, opts)
+}
+
+// Stop and start of a bound daemon, run outside bindingsMu
+type reload struct {
+	b     *binding
+	h     *Handle // running or stopping handle, nil if not running
+	stop  bool
+	start bool
+}
+
+// Applies the Specs of bound config keys to their daemons: starts enabled daemons,
+// stops disabled daemons (Interval < 0), reschedules or restarts changed daemons;
+// invalid Specs are skipped. Logs and returns the applied changes.
+// Restarted daemons start once their last run finishes
+func ApplySpecs(specs map[string]Spec) []string {
+	changes, reloads := planSpecs(specs)
+	for _, r := range reloads {
+		r.run()
+	}
+	return changes
+}
+
+// Updates the bound Specs and reschedules changed daemons,
+// returns the applied changes and the stops and starts to run
+func planSpecs(specs map[string]Spec) ([]string, []reload) {
+	bindingsMu.Lock()
+	defer bindingsMu.Unlock()
+	keys := make([]string, 0, len(specs))
+	for key := range specs {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	changes := make([]string, 0)
+	reloads := make([]reload, 0)
+	for _, key := range keys {
+		b, ok := bindings[key]
+		if !ok {
+			continue
+		}
+		spec := specs[key]
+		if spec == b.spec {
+			continue
+		}
+		if err := spec.Validate(); err != nil {
+			fmt.Printf("Daemon:%s config %s not applied: %v\n", b.name, key, err)
+			continue
+		}
+		action, r := b.apply(spec)
+		if r.stop || r.start {
+			reloads = append(reloads, r)
+		}
+		change := fmt.Sprintf("Daemon:%s %s: %s => %s", b.name, action, specText(b.spec), specText(spec))
+		fmt.Println(change)
+		changes = append(changes, change)
+		b.spec = spec
+	}
+	return changes, reloads
+}
+
+// Runs a daemon that reloads the Daemon Config file every given interval
+// and applies its Specs to the bound daemons if the file changed; returns the daemon handle.
+// If the file fails to load or validate, the current config is kept.
+// TimeScale = time.Hour, time.Minute, time.Second
+func WatchConfig[T any](name, path string, interval int, timeScale time.Duration) *Handle {
+	var modTime time.Time
+	return RunTask(name, func(context.Context) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Equal(modTime) {
+			return nil
+		}
+		modTime = info.ModTime() // invalid file is reported once, until changed again
+		cfg, err := LoadConfig[T](path)
+		if err != nil {
+			return err
+		}
+		specs, err := configSpecs(cfg)
+		if err != nil {
+			return err
+		}
+		ApplySpecs(specs)
+		return nil
+	}, interval, timeScale, &Options{Overlap: OverlapSkip})
+}
+
+// Parse Spec from config text: number interval, cron expression,
+// or JSON object, e.g. "15", "0 3 * * *", `{"Interval": 60, "Jitter": "1m"}`
+func ParseSpec(text string) (Spec, error) {
+	text = strings.TrimSpace(text)
+	var spec Spec
+	err := json.Unmarshal([]byte(text), &spec)
+	if err != nil && !strings.HasPrefix(text, "{") {
+		spec, err = Spec{Cron: text}, nil
+	}
+	if err == nil {
+		err = spec.Validate()
+	}
+	return spec, err
+}
+
+// Applies the new Spec to the bound daemon: reschedules it in place,
+// or returns the stop and start to run; returns the action taken
+func (b *binding) apply(spec Spec) (string, reload) {
+	h, ok := Get(b.name)
+	isRunning := ok && h.ctx.Err() == nil
+	r := reload{b: b, h: h}
+	switch {
+	case !spec.isEnabled() && !isRunning:
+		return "stays disabled", r
+	case !spec.isEnabled():
+		r.stop = true
+		return "disabled", r
+	case !isRunning:
+		r.start = true // after the stopping daemon, if any, finishes
+		return "enabled", r
+	case spec.Jitter != b.spec.Jitter || spec.Align != b.spec.Align:
+		r.stop, r.start = true, true
+		return "restarted", r
+	}
+	opts := spec.options(b.opts)
+	if spec.Cron != "" {
+		schedule, _ := ParseCron(spec.Cron, opts.Location) // validated
+		h.SetSchedule(schedule)
+	} else {
+		h.SetSchedule(newIntervalSchedule(time.Duration(spec.Interval)*b.timeScale, opts))
+	}
+	return "rescheduled", r
+}
+
+// Stops the old daemon, then starts the new one once the old one is done,
+// so that the new daemon is not mistaken for the old one still registered under its name
+func (r reload) run() {
+	if r.stop {
+		if err := r.h.Stop(reloadStopTimeout); err != nil {
+			fmt.Printf("Daemon:%s %v\n", r.b.name, err)
+		}
+	}
+	if !r.start {
+		return
+	}
+	if r.h == nil {
+		r.b.start()
+		return
+	}
+	select {
+	case <-r.h.Done():
+		r.b.start()
+	default:
+		fmt.Printf("Daemon:%s starts after its last run finishes\n", r.b.name)
+		go func() {
+			<-r.h.Done()
+			r.b.start()
+		}()
+	}
+}
+
+// Starts the bound daemon with its current Spec, unless disabled or already running
+func (b *binding) start() {
+	bindingsMu.Lock()
+	defer bindingsMu.Unlock()
+	if _, ok := Get(b.name); ok || !b.spec.isEnabled() {
+		return
+	}
+	_, err := RunSpec(b.name, b.task, b.spec, b.timeScale, b.opts)
+	if err != nil {
+		fmt.Printf("Daemon:%s %v\n", b.name, err)
+	}
+}
+
+// Spec as config text
+func specText(spec Spec) string {
+	text, _ := json.Marshal(spec)
+	return string(text)
+}
@@ -0,0 +1,165 @@
+package daemon
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultHistorySize = 50
+
+// Result of a daemon run
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+	OutcomeTimeout Outcome = "timeout"
+)
+
+// Record of a daemon run
+type RunRecord struct {
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Outcome  Outcome
+	Error    string
+}
+
+// Runtime statistics of the runs in history
+type Stats struct {
+	Count   int
+	Average time.Duration
+	P95     time.Duration
+	Max     time.Duration
+}
+
+// Run counts and bounded run history of a daemon
+type runStats struct {
+	mu                  sync.Mutex
+	historySize         int
+	history             []RunRecord // oldest first
+	runs                int
+	failures            int
+	consecutiveFailures int
+	timeouts            int
+	skipped             int
+	lastRun             time.Time
+	nextRun             time.Time
+	lastError           string
+	lastSuccess         time.Time
+}
+
+// Create RunRecord from its start, end, and error
+func newRunRecord(start, end time.Time, err error) RunRecord {
+	run := RunRecord{
+		Start:    start,
+		End:      end,
+		Duration: end.Sub(start),
+		Outcome:  OutcomeSuccess,
+	}
+	if err != nil {
+		run.Outcome = OutcomeFailure
+		if errors.Is(err, errRunTimeout) {
+			run.Outcome = OutcomeTimeout
+		}
+		run.Error = err.Error()
+	}
+	return run
+}
+
+// Record a finished run, returns the number of consecutive failures
+// and whether it changed with this run
+func (s *runStats) record(run RunRecord) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	streak := s.consecutiveFailures
+	s.runs += 1
+	switch run.Outcome {
+	case OutcomeSuccess:
+		s.consecutiveFailures = 0
+		s.lastSuccess = run.End
+	case OutcomeTimeout:
+		s.timeouts += 1
+		fallthrough
+	default:
+		s.failures += 1
+		s.consecutiveFailures += 1
+		s.lastError = run.Error
+	}
+	size := s.historySize
+	if size == 0 {
+		size = defaultHistorySize
+	}
+	s.history = append(s.history, run)
+	if len(s.history) > size {
+		s.history = slices.Delete(s.history, 0, len(s.history)-size)
+	}
+	return s.consecutiveFailures, s.consecutiveFailures != streak
+}
+
+// Record a skipped run
+func (s *runStats) skip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped += 1
+}
+
+// Set the start time of the latest run
+func (s *runStats) setLastRun(start time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun = start
+}
+
+// Set the time of the next scheduled run
+func (s *runStats) setNextRun(next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRun = next
+}
+
+// Get the number of consecutive failures
+func (s *runStats) failureStreak() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.consecutiveFailures
+}
+
+// Copy stats into Info
+func (s *runStats) fill(info *Info) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info.Last = s.lastRun
+	info.NextRun = s.nextRun
+	info.Runs = s.runs
+	info.Failures = s.failures
+	info.ConsecutiveFailures = s.consecutiveFailures
+	info.Timeouts = s.timeouts
+	info.Skipped = s.skipped
+	info.LastError = s.lastError
+	info.LastSuccess = s.lastSuccess
+	info.Stats = computeStats(s.history)
+	info.History = slices.Clone(s.history)
+	slices.Reverse(info.History)
+}
+
+// Compute the runtime stats of the runs
+func computeStats(runs []RunRecord) Stats {
+	stats := Stats{Count: len(runs)}
+	if len(runs) == 0 {
+		return stats
+	}
+	durations := make([]time.Duration, len(runs))
+	var total time.Duration
+	for i, run := range runs {
+		durations[i] = run.Duration
+		total += run.Duration
+	}
+	slices.Sort(durations)
+	stats.Average = total / time.Duration(len(runs))
+	stats.P95 = durations[(len(durations)*95+99)/100-1] // nearest rank
+	stats.Max = durations[len(durations)-1]
+	return stats
+}
@@ -0,0 +1,202 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+)
+
+var errPanic = errors.New("daemon task panicked")
+
+const maxBackoffShift = 16 // cap on the backoff multiplier: 2^16
+
+// Daemon task that reports failure through its error
+type Task = func(context.Context) error
+
+// Daemon options, nil = defaults
+type Options struct {
+	// If > 0, the wait after consecutive failures doubles per failure
+	// (interval * 2^failures), up to MaxBackoff
+	MaxBackoff time.Duration
+	// Timezone of cron and aligned schedules, nil = time.Local
+	Location *time.Location
+	// Wait before the first run, counted from daemon start
+	InitialDelay time.Duration
+	// If > 0, each run is delayed by a random duration in [0, Jitter),
+	// so that daemons with the same schedule do not all run at once
+	Jitter time.Duration
+	// If true, interval runs are aligned to multiples of the interval
+	// counted from midnight in Location, e.g. 1h runs on the hour
+	Align bool
+	// Policy when a run is due while the previous run is in progress, default OverlapQueue
+	Overlap Overlap
+	// If > 0, cancels the task's context after Timeout and records the run as timed out
+	Timeout time.Duration
+	// Number of recent runs kept in history, 0 = defaultHistorySize
+	HistorySize int
+	// If set, a run only starts if this instance holds the daemon's lease,
+	// so the daemon runs on one instance at a time
+	Lease LeaseStore
+	// Lease duration, renewed every LeaseTTL/3 while the daemon is running; 0 = 1 minute.
+	// Another instance takes over if the holder does not renew within LeaseTTL
+	LeaseTTL time.Duration
+}
+
+// Runs an error-returning task every given interval, returns the daemon handle (nil if disabled);
+// panics are recovered and counted as failures, the context is cancelled when the daemon is stopped.
+// TimeScale = time.Hour, time.Minute, time.Second
+func RunTask(name string, task Task, interval int, timeScale time.Duration, opts *Options) *Handle {
+	if interval < 0 {
+		fmt.Printf("Daemon:%s is disabled\n", name)
+		return nil
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	return start(name, newIntervalSchedule(time.Duration(interval)*timeScale, opts), task, opts)
+}
+
+// Runs an error-returning task on a cron schedule, e.g. "0 3 * * *", in opts.Location;
+// returns the daemon handle, or an error if the cron expression is invalid
+func RunCron(name string, task Task, expr string, opts *Options) (*Handle, error) {
+	var location *time.Location
+	if opts != nil {
+		location = opts.Location
+	}
+	schedule, err := ParseCron(expr, location)
+	if err != nil {
+		return nil, err
+	}
+	return start(name, schedule, task, opts), nil
+}
+
+// Runs an error-returning task following the Spec: cron schedule or interval * timeScale;
+// returns the daemon handle (nil if disabled), or an error if the cron expression is invalid
+func RunSpec(name string, task Task, spec Spec, timeScale time.Duration, opts *Options) (*Handle, error) {
+	if spec.Cron != "" {
+		return RunCron(name, task, spec.Cron, spec.options(opts))
+	}
+	return RunTask(name, task, spec.Interval, timeScale, spec.options(opts)), nil
+}
+
+// Common: registers the daemon and starts its loop
+func start(name string, schedule Schedule, task Task, opts *Options) *Handle {
+	if h, ok := daemons.Get(name); ok {
+		fmt.Printf("Daemon:%s is already running\n", name)
+		return h
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Handle{
+		name:     name,
+		started:  clock.Now(),
+		schedule: schedule,
+		task:     task,
+		opts:     *opts,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+	}
+	h.stats.historySize = opts.HistorySize
+	if opts.Lease != nil {
+		h.leader = newLeader(opts.Lease, name, InstanceID(), opts.LeaseTTL)
+	}
+	daemons.Set(name, h)
+	go h.loop()
+	return h
+}
+
+// Daemon loop: dispatches runs following the schedule until the daemon is stopped,
+// then waits for in-flight runs; interval schedules run after InitialDelay,
+// cron and aligned schedules wait for the first match after InitialDelay.
+// Paused daemons skip scheduled runs
+func (h *Handle) loop() {
+	defer close(h.done)
+	defer unregister(h)
+	if h.leader != nil {
+		h.leader.start()
+		defer h.leader.stop() // after in-flight runs, so no other instance runs meanwhile
+	}
+	defer h.inFlight.Wait()
+	defer h.markStopped()
+	last := clock.Now()
+	next := h.firstRun(last)
+	for {
+		h.stats.setNextRun(next)
+		switch sleepUntil(h.ctx, next, h.wake) {
+		case wakeStop:
+			return
+		case wakeReschedule:
+			next = h.nextRun(last, h.stats.failureStreak())
+			continue
+		}
+		last = clock.Now()
+		if !h.IsPaused() {
+			h.dispatch()
+		}
+		next = h.nextRun(last, h.stats.failureStreak())
+	}
+}
+
+// Get the time of the first run: InitialDelay after start,
+// or the first scheduled run after that for cron and aligned schedules
+func (h *Handle) firstRun(start time.Time) time.Time {
+	first := start.Add(h.opts.InitialDelay)
+	if _, isInterval := h.getSchedule().(intervalSchedule); !isInterval {
+		first = h.getSchedule().Next(first)
+	}
+	return h.addJitter(first)
+}
+
+// Get the time of the next run, backing off after consecutive failures:
+// the gap to the next scheduled run doubles per failure, up to MaxBackoff
+func (h *Handle) nextRun(last time.Time, failures int) time.Time {
+	next := h.getSchedule().Next(last)
+	if failures == 0 || h.opts.MaxBackoff <= 0 || next.IsZero() {
+		return h.addJitter(next)
+	}
+	gap := next.Sub(last)
+	wait := gap << min(failures, maxBackoffShift)
+	if wait <= 0 || wait > h.opts.MaxBackoff {
+		wait = max(h.opts.MaxBackoff, gap)
+	}
+	return h.addJitter(last.Add(wait))
+}
+
+// Delay the run by a random duration in [0, Jitter)
+func (h *Handle) addJitter(next time.Time) time.Time {
+	if h.opts.Jitter <= 0 || next.IsZero() {
+		return next
+	}
+	return next.Add(rand.N(h.opts.Jitter))
+}
+
+// Get the interval schedule, aligned to wall-clock boundaries if opts.Align
+func newIntervalSchedule(interval time.Duration, opts *Options) Schedule {
+	if !opts.Align {
+		return intervalSchedule(interval)
+	}
+	location := opts.Location
+	if location == nil {
+		location = time.Local
+	}
+	return alignedSchedule{interval, location}
+}
+
+// Runs the task, recovers from panic as an error with the stack trace
+func runOnce(ctx context.Context, task Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v\n%s", errPanic, r, debug.Stack())
+		}
+	}()
+	return task(ctx)
+}
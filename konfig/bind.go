@@ -0,0 +1,175 @@
+package konfig
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/rdb/ze"
+)
+
+const (
+	keyTag       string = "konfig"  // Struct tag for <Domain>.<Key>, or <Domain>.* for sub-structs
+	defaultTag   string = "default" // Struct tag for default value
+	domainSuffix string = ".*"      // konfig tag suffix of sub-struct fields
+)
+
+// Config struct field bound to a config key
+type field struct {
+	Key        string       // <Domain>.<Key>
+	Path       string       // dotted struct field path
+	Index      []int        // struct field index path
+	Default    string       // default value, in config_app format
+	HasDefault bool         // default tag is present
+	Type       reflect.Type // struct field type
+}
+
+// Get the config keys declared in the konfig tags of T
+func Keys[T any]() []string {
+	fields := fieldsOf[T]()
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i] = f.Key
+	}
+	return keys
+}
+
+// Fills the konfig-tagged fields of cfg using lookup,
+// fallsback to the default tag value if key is not in lookup.
+// Returns an error listing every key that failed to parse or failed its constraints
+func Bind[T any](cfg *T, lookup dict.StringMap) (*T, error) {
+	fe := newFieldErrors()
+	structValue := reflect.ValueOf(cfg).Elem()
+	for _, f := range fieldsOf[T]() {
+		text, ok := lookup[f.Key]
+		if !ok && !f.HasDefault {
+			continue // keep current field value
+		} else if !ok {
+			text = f.Default
+		}
+		if err := checkSecretField(f.Key, f.Type); err != nil {
+			fe.add(f.Key, f.Path, err)
+			continue
+		}
+		value, err := parseValue(text, f.Type)
+		if err != nil {
+			fe.add(f.Key, f.Path, err)
+			continue
+		}
+		structValue.FieldByIndex(f.Index).Set(value)
+	}
+	if err := fe.check(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Fills the konfig-tagged fields of cfg using the lookup entries under domain,
+// e.g. domain=Billing.Invoice binds Billing.Invoice.DueDays to the field tagged DueDays
+func BindDomain[T any](cfg *T, lookup dict.StringMap, domain string) (*T, error) {
+	prefix := domain + keyGlue
+	domainLookup := make(dict.StringMap)
+	for key, value := range lookup {
+		if strings.HasPrefix(key, prefix) {
+			domainLookup[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+	return Bind(cfg, domainLookup)
+}
+
+// Load config T from database, using the keys declared in its konfig tags
+func Load[T any](rq *ze.Request) (*T, error) {
+	lookup, err := Lookup(rq, Keys[T]())
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Bind(new(T), lookup)
+	if err != nil {
+		rq.AddErrorLog(err)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Load config T from database, using the keys declared in its konfig tags under domain
+func LoadDomain[T any](rq *ze.Request, domain string) (*T, error) {
+	keys := DomainKeys(domain, Keys[T]())
+	lookup, err := Lookup(rq, keys)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := BindDomain(new(T), lookup, domain)
+	if err != nil {
+		rq.AddErrorLog(err)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Prefix each key with domain
+func DomainKeys(domain string, keys []string) []string {
+	domainKeys := make([]string, len(keys))
+	for i, key := range keys {
+		domainKeys[i] = domain + keyGlue + key
+	}
+	return domainKeys
+}
+
+// Get the konfig-tagged fields of T, including the fields of
+// embedded structs and of sub-structs tagged with <Domain>.*
+func fieldsOf[T any]() []field {
+	structType := reflect.TypeFor[T]()
+	if structType.Kind() != reflect.Struct {
+		return []field{}
+	}
+	return collectFields(structType, "", "", nil)
+}
+
+// Common: collect konfig-tagged fields of struct type, recursing into sub-structs;
+// keyPrefix, pathPrefix, and index are the config key, field path, and index path of the struct
+func collectFields(structType reflect.Type, keyPrefix, pathPrefix string, index []int) []field {
+	fields := make([]field, 0)
+	for i := range structType.NumField() {
+		structField := structType.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		fieldIndex := append(slices.Clone(index), i)
+		key := structField.Tag.Get(keyTag)
+		if structField.Anonymous && structField.Type.Kind() == reflect.Struct {
+			fields = append(fields, collectFields(structField.Type, keyPrefix, pathPrefix, fieldIndex)...)
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		key = joinKey(keyPrefix, key)
+		path := joinKey(pathPrefix, structField.Name)
+		if strings.HasSuffix(key, domainSuffix) && structField.Type.Kind() == reflect.Struct {
+			domain := strings.TrimSuffix(key, domainSuffix)
+			fields = append(fields, collectFields(structField.Type, domain, path, fieldIndex)...)
+			continue
+		}
+		defaultValue, hasDefault := structField.Tag.Lookup(defaultTag)
+		fields = append(fields, field{
+			Key:        key,
+			Path:       path,
+			Index:      fieldIndex,
+			Default:    defaultValue,
+			HasDefault: hasDefault,
+			Type:       structField.Type,
+		})
+	}
+	return fields
+}
+
+// Join prefix and name with keyGlue, skips blank prefix
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + keyGlue + name
+}
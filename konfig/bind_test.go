@@ -0,0 +1,98 @@
+package konfig
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/roidaradal/fn/dict"
+)
+
+type testAuditConfig struct {
+	Enabled bool `konfig:"Enabled" default:"true"`
+	Retain  uint `konfig:"RetainDays" default:"30"`
+}
+
+type testBillingConfig struct {
+	DueDays  uint            `konfig:"DueDays" default:"30"`
+	Currency string          `konfig:"Currency" default:"USD"`
+	Audit    testAuditConfig `konfig:"Audit.*"`
+}
+
+type CommonTestConfig struct {
+	Timeout time.Duration `konfig:"App.Timeout" default:"5s"`
+}
+
+type testAppConfig struct {
+	CommonTestConfig
+	Name    string            `konfig:"App.Name"`
+	Billing testBillingConfig `konfig:"Billing.*"`
+}
+
+func TestKeysOfNestedStructs(t *testing.T) {
+	got := Keys[testAppConfig]()
+	want := []string{
+		"App.Timeout",
+		"App.Name",
+		"Billing.DueDays",
+		"Billing.Currency",
+		"Billing.Audit.Enabled",
+		"Billing.Audit.RetainDays",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Keys = %v, want %v", got, want)
+	}
+}
+
+func TestLoadNestedStructs(t *testing.T) {
+	useMemoryStore(t, dict.StringMap{
+		"App.Name":                 "krap",
+		"App.Timeout":              "1m",
+		"Billing.Currency":         "EUR",
+		"Billing.Audit.RetainDays": "90",
+		"Other.Key":                "ignored",
+	})
+	cfg, err := Load[testAppConfig](newTestRequest(t))
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	want := testAppConfig{
+		CommonTestConfig: CommonTestConfig{Timeout: time.Minute},
+		Name:             "krap",
+		Billing: testBillingConfig{
+			DueDays:  30, // default
+			Currency: "EUR",
+			Audit:    testAuditConfig{Enabled: true, Retain: 90},
+		},
+	}
+	if *cfg != want {
+		t.Errorf("Load = %+v, want %+v", *cfg, want)
+	}
+}
+
+func TestLoadDomain(t *testing.T) {
+	useMemoryStore(t, dict.StringMap{
+		"Tenant.Billing.DueDays":       "15",
+		"Tenant.Billing.Audit.Enabled": "false",
+	})
+	cfg, err := LoadDomain[testBillingConfig](newTestRequest(t), "Tenant.Billing")
+	if err != nil {
+		t.Fatalf("LoadDomain error: %v", err)
+	}
+	want := testBillingConfig{DueDays: 15, Currency: "USD", Audit: testAuditConfig{Enabled: false, Retain: 30}}
+	if *cfg != want {
+		t.Errorf("LoadDomain = %+v, want %+v", *cfg, want)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	useMemoryStore(t, dict.StringMap{
+		"Billing.DueDays":       "-1",
+		"Billing.Audit.Enabled": "maybe",
+	})
+	_, err := Load[testAppConfig](newTestRequest(t))
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Load error = %v, want ErrInvalidConfig", err)
+	}
+}
@@ -0,0 +1,181 @@
+package konfig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	minTag      string = "min"      // minimum number value, or minimum string/list length
+	maxTag      string = "max"      // maximum number value, or maximum string/list length
+	enumTag     string = "enum"     // allowed values, separated by listGlue
+	regexTag    string = "regex"    // pattern that string / list items must match
+	nonEmptyTag string = "nonempty" // string / list must not be empty
+)
+
+var errConstraint = errors.New("constraint failed")
+
+// Accumulates the parse errors and the failed field paths of a config object
+type fieldErrors struct {
+	errs  []error
+	paths []string
+}
+
+// Create new fieldErrors
+func newFieldErrors() *fieldErrors {
+	return &fieldErrors{
+		errs:  make([]error, 0),
+		paths: make([]string, 0),
+	}
+}
+
+// Add error for given key and struct field path
+func (fe *fieldErrors) add(key, path string, err error) {
+	fe.errs = append(fe.errs, fmt.Errorf("%s: %w", key, err))
+	fe.paths = append(fe.paths, path)
+}
+
+// Check the constraints of cfg fields that did not fail parsing,
+// returns all errors combined into one ErrInvalidConfig error
+func (fe *fieldErrors) check(cfg any) error {
+	errs := append(fe.errs, checkConstraints(cfg, fe.paths)...)
+	return joinErrors(errs)
+}
+
+// Checks the constraint tags of all exported fields of cfg, except the skipPaths;
+// returns one error per failed field, labelled with the config key
+func checkConstraints(cfg any, skipPaths []string) []error {
+	return checkStruct(reflect.ValueOf(cfg).Elem(), "", "", skipPaths)
+}
+
+// Common: checks the constraint tags of the exported fields of struct value, recursing into nested structs;
+// keyPrefix and pathPrefix are the config key and field path of the struct
+func checkStruct(structValue reflect.Value, keyPrefix, pathPrefix string, skipPaths []string) []error {
+	errs := make([]error, 0)
+	structType := structValue.Type()
+	for i := range structType.NumField() {
+		structField := structType.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		value := structValue.Field(i)
+		if structField.Anonymous && value.Kind() == reflect.Struct {
+			errs = append(errs, checkStruct(value, keyPrefix, pathPrefix, skipPaths)...)
+			continue
+		}
+		path := joinKey(pathPrefix, structField.Name)
+		if slices.Contains(skipPaths, path) {
+			continue
+		}
+		key := structField.Tag.Get(keyTag)
+		if key == "" {
+			key = structField.Name
+		}
+		key = joinKey(keyPrefix, key)
+		if value.Kind() == reflect.Struct && value.Type() != timeType {
+			domain := strings.TrimSuffix(key, domainSuffix)
+			errs = append(errs, checkStruct(value, domain, path, skipPaths)...)
+			continue
+		}
+		err := checkField(structField, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return errs
+}
+
+// Check the constraint tags of struct field against its value
+func checkField(structField reflect.StructField, value reflect.Value) error {
+	tag := structField.Tag
+	if limit, ok := tag.Lookup(minTag); ok {
+		if err := checkLimit(value, limit, false); err != nil {
+			return err
+		}
+	}
+	if limit, ok := tag.Lookup(maxTag); ok {
+		if err := checkLimit(value, limit, true); err != nil {
+			return err
+		}
+	}
+	if tag.Get(nonEmptyTag) == "true" && isEmpty(value) {
+		return fmt.Errorf("%w: must not be empty", errConstraint)
+	}
+	if options, ok := tag.Lookup(enumTag); ok {
+		allowed := splitList(options)
+		for _, item := range textItems(value) {
+			if !slices.Contains(allowed, item) {
+				return fmt.Errorf("%w: %q is not one of %v", errConstraint, item, allowed)
+			}
+		}
+	}
+	if pattern, ok := tag.Lookup(regexTag); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %w", pattern, err)
+		}
+		for _, item := range textItems(value) {
+			if !re.MatchString(item) {
+				return fmt.Errorf("%w: %q does not match %s", errConstraint, item, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Check value against min/max limit:
+// numbers are compared by value, strings and lists by length
+func checkLimit(value reflect.Value, limitText string, isMax bool) error {
+	limit, err := strconv.ParseFloat(limitText, 64)
+	if err != nil {
+		return fmt.Errorf("invalid limit %q", limitText)
+	}
+	var actual float64
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = value.Float()
+	case reflect.String, reflect.Slice, reflect.Map:
+		actual = float64(value.Len())
+	default:
+		return nil
+	}
+	if isMax && actual > limit {
+		return fmt.Errorf("%w: %v is above max %s", errConstraint, actual, limitText)
+	}
+	if !isMax && actual < limit {
+		return fmt.Errorf("%w: %v is below min %s", errConstraint, actual, limitText)
+	}
+	return nil
+}
+
+// Check if string / list / map value is empty
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// Get the text form of value: string => [value], list => items
+func textItems(value reflect.Value) []string {
+	switch value.Kind() {
+	case reflect.Slice:
+		items := make([]string, value.Len())
+		for i := range value.Len() {
+			items[i] = fmt.Sprintf("%v", value.Index(i).Interface())
+		}
+		return items
+	default:
+		return []string{fmt.Sprintf("%v", value.Interface())}
+	}
+}
@@ -0,0 +1,120 @@
+package konfig
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/roidaradal/fn/dict"
+)
+
+func TestCheckLimit(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   any
+		limit   string
+		isMax   bool
+		wantErr bool
+	}{
+		{"int above min", 5, "1", false, false},
+		{"int at min", 1, "1", false, false},
+		{"int below min", 0, "1", false, true},
+		{"negative int below min", -5, "-1", false, true},
+		{"uint at max", uint(10), "10", true, false},
+		{"uint above max", uint(11), "10", true, true},
+		{"float below max", 0.5, "1", true, false},
+		{"float above max", 1.5, "1", true, true},
+		{"float limit", 2, "2.5", true, false},
+		{"string length at max", "abc", "3", true, false},
+		{"string length above max", "abcd", "3", true, true},
+		{"string length below min", "", "1", false, true},
+		{"numeric string uses length", "100", "5", true, false},
+		{"list length below min", []string{"a"}, "2", false, true},
+		{"list length above max", []int{1, 2, 3}, "2", true, true},
+		{"map length at max", map[string]string{"a": "1"}, "1", true, false},
+		{"bool ignored", true, "0", true, false},
+		{"invalid limit", 1, "one", false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkLimit(reflect.ValueOf(tc.value), tc.limit, tc.isMax)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("checkLimit(%v, %s, max=%v) error = %v, want error: %v", tc.value, tc.limit, tc.isMax, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+type testConstrained struct {
+	Port    int      `konfig:"App.Port" min:"1" max:"65535"`
+	Mode    string   `konfig:"App.Mode" enum:"dev|prod"`
+	Regions []string `konfig:"App.Regions" enum:"us|eu|ap" nonempty:"true"`
+	Codes   []string `konfig:"App.Codes" regex:"^[A-Z]{3}$" max:"3"`
+	Name    string   `konfig:"App.Name" regex:"^[a-z]+$"`
+	Owner   string   `konfig:"App.Owner" nonempty:"true"`
+}
+
+func TestCheckConstraints(t *testing.T) {
+	valid := testConstrained{Port: 80, Mode: "prod", Regions: []string{"us", "eu"}, Codes: []string{"USD"}, Name: "krap", Owner: "ops"}
+	testCases := []struct {
+		name    string
+		change  func(cfg *testConstrained)
+		wantKey string // "" = valid
+	}{
+		{"valid", func(cfg *testConstrained) {}, ""},
+		{"number below min", func(cfg *testConstrained) { cfg.Port = 0 }, "App.Port"},
+		{"number above max", func(cfg *testConstrained) { cfg.Port = 70000 }, "App.Port"},
+		{"string not in enum", func(cfg *testConstrained) { cfg.Mode = "test" }, "App.Mode"},
+		{"list item not in enum", func(cfg *testConstrained) { cfg.Regions = []string{"us", "mars"} }, "App.Regions"},
+		{"empty list", func(cfg *testConstrained) { cfg.Regions = nil }, "App.Regions"},
+		{"list item not matching regex", func(cfg *testConstrained) { cfg.Codes = []string{"USD", "eur"} }, "App.Codes"},
+		{"empty list matches regex", func(cfg *testConstrained) { cfg.Codes = []string{} }, ""},
+		{"list longer than max", func(cfg *testConstrained) { cfg.Codes = []string{"AAA", "BBB", "CCC", "DDD"} }, "App.Codes"},
+		{"string not matching regex", func(cfg *testConstrained) { cfg.Name = "Krap" }, "App.Name"},
+		{"empty string", func(cfg *testConstrained) { cfg.Owner = "" }, "App.Owner"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := valid
+			tc.change(&cfg)
+			errs := checkConstraints(&cfg, nil)
+			if tc.wantKey == "" {
+				if len(errs) > 0 {
+					t.Errorf("checkConstraints = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 {
+				t.Fatalf("checkConstraints = %v, want 1 error", errs)
+			}
+			if !errors.Is(errs[0], errConstraint) || !strings.HasPrefix(errs[0].Error(), tc.wantKey+": ") {
+				t.Errorf("checkConstraints error = %v, want %s constraint error", errs[0], tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestInvalidConfigError(t *testing.T) {
+	lookup := dict.StringMap{
+		"App.Port":    "http", // parse error: constraints are not checked
+		"App.Mode":    "test",
+		"App.Regions": "us|mars",
+		"App.Name":    "krap",
+		"App.Owner":   "ops",
+	}
+	_, err := Bind(new(testConstrained), lookup)
+	if !errors.Is(err, ErrInvalidConfig) || !errors.Is(err, errInvalidValue) || !errors.Is(err, errConstraint) {
+		t.Fatalf("Bind error = %v, want ErrInvalidConfig with parse and constraint errors", err)
+	}
+	lines := strings.Split(err.Error(), "\n")
+	want := []string{
+		"invalid config: 3 errors encountered:",
+		`App.Port: invalid value: "http" is not an int`,
+		`App.Mode: constraint failed: "test" is not one of [dev prod]`,
+		`App.Regions: constraint failed: "mars" is not one of [us eu ap]`,
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Bind error =\n%s\nwant\n%s", err, strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,41 @@
+package konfig
+
+import (
+	"maps"
+	"time"
+
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/krap/daemon"
+	"github.com/roidaradal/krap/sys"
+)
+
+// Runs a daemon that reloads the daemon Specs under the given domains every given interval,
+// and applies changed Specs to the daemons bound with daemon.RunConfigured; returns the daemon handle.
+// Values are parsed with daemon.ParseSpec, invalid values are logged and skipped.
+// TimeScale = time.Hour, time.Minute, time.Second
+func WatchDaemons(name string, interval int, timeScale time.Duration, domains ...string) *daemon.Handle {
+	var current dict.StringMap
+	return daemon.Run(name, func() {
+		rq, err := newRequest("konfig.WatchDaemons: %s", name)
+		var lookup dict.StringMap
+		if err == nil {
+			lookup, err = LookupDomains(rq, domains...)
+		}
+		if err != nil || maps.Equal(lookup, current) {
+			sys.DisplayResult(rq, err)
+			return
+		}
+		current = lookup
+		specs := make(map[string]daemon.Spec, len(lookup))
+		for key, value := range lookup {
+			spec, err := daemon.ParseSpec(value)
+			if err != nil {
+				rq.AddFmtLog("Invalid daemon config %s: %v", key, err)
+				continue
+			}
+			specs[key] = spec
+		}
+		daemon.ApplySpecs(specs) // logs the applied changes
+		sys.DisplayResult(rq, nil)
+	}, interval, timeScale)
+}
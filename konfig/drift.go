@@ -0,0 +1,235 @@
+package konfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/krap/root"
+	"github.com/roidaradal/krap/sys"
+	"github.com/roidaradal/rdb/ze"
+)
+
+var errConfigDrift = errors.New("config drift")
+
+// Expected config key: its default value in config_app format and its value type;
+// IsJSON for Defaults.JSONMap keys, whose values are JSON text
+type KeySpec struct {
+	Default    string
+	HasDefault bool
+	Type       reflect.Type
+	IsJSON     bool
+}
+
+// Config key => KeySpec
+type Specs = map[string]KeySpec
+
+// Differences between the expected config keys and the config_app rows
+type Drift struct {
+	Missing  []string       // expected keys not in config_app
+	Orphaned []string       // config_app keys not expected
+	Invalid  dict.StringMap // config_app keys whose values fail to parse => error message
+}
+
+// Check if there is any drift
+func (d Drift) HasDrift() bool {
+	return len(d.Missing) > 0 || len(d.Orphaned) > 0 || len(d.Invalid) > 0
+}
+
+// Get the Specs of the konfig-tagged fields of T
+func SpecsOf[T any]() Specs {
+	specs := make(Specs)
+	for _, f := range fieldsOf[T]() {
+		specs[f.Key] = KeySpec{
+			Default:    f.Default,
+			HasDefault: f.HasDefault,
+			Type:       f.Type,
+		}
+	}
+	return specs
+}
+
+// Get the Specs of the keys in Defaults
+func (d *Defaults) Specs() Specs {
+	specs := make(Specs)
+	addSpecs(specs, d.UintMap)
+	addSpecs(specs, d.IntMap)
+	addSpecs(specs, d.FloatMap)
+	addSpecs(specs, d.BoolMap)
+	addSpecs(specs, d.StringMap)
+	addSpecs(specs, d.StringListMap)
+	addSpecs(specs, d.StringMapMap)
+	addSpecs(specs, d.DurationMap)
+	addSpecs(specs, d.TimeMap)
+	for key, value := range d.JSONMap {
+		text, _ := json.Marshal(value)
+		specs[key] = KeySpec{string(text), true, reflect.TypeOf(value), true}
+	}
+	return specs
+}
+
+// Compare the expected config keys against the current KVStore (default: config_app)
+func CheckDrift(rq *ze.Request, specs Specs) (*Drift, error) {
+	return checkDrift(rq, CurrentKVStore(), specs)
+}
+
+// Compare the expected config keys against the store
+func checkDrift(rq *ze.Request, store KVStore, specs Specs) (*Drift, error) {
+	current, err := store.All(rq)
+	if err != nil {
+		return nil, err
+	}
+	drift := &Drift{
+		Missing:  make([]string, 0),
+		Orphaned: make([]string, 0),
+		Invalid:  make(dict.StringMap),
+	}
+	for key, storedValue := range current {
+		spec, ok := specs[key]
+		if !ok {
+			drift.Orphaned = append(drift.Orphaned, key)
+			continue
+		}
+		if spec.Type == nil {
+			continue
+		}
+		value, err := openValue(storedValue)
+		if err == nil && spec.IsJSON {
+			_, err = parseJSON(value, spec.Type)
+		} else if err == nil {
+			_, err = parseValue(value, spec.Type)
+		}
+		if err != nil && (IsSecret(key) || isEncrypted(storedValue)) {
+			drift.Invalid[key] = errInvalidSecret.Error() // do not show secret value
+		} else if err != nil {
+			drift.Invalid[key] = err.Error()
+		}
+	}
+	for key := range specs {
+		if dict.NoKey(current, key) {
+			drift.Missing = append(drift.Missing, key)
+		}
+	}
+	slices.Sort(drift.Missing)
+	slices.Sort(drift.Orphaned)
+	return drift, nil
+}
+
+// Inserts the missing config_app keys that have defaults, returns the seeded keys
+func SeedDefaults(rq *ze.Request, specs Specs, updatedBy string) ([]string, error) {
+	drift, err := checkDrift(rq, DBStore{}, specs)
+	if err != nil {
+		return nil, err
+	}
+	values := make(dict.StringMap)
+	for _, key := range drift.Missing {
+		if spec := specs[key]; spec.HasDefault {
+			values[key] = spec.Default
+		}
+	}
+	if len(values) == 0 {
+		return []string{}, nil
+	}
+	err = SetMany(rq, values, updatedBy)
+	if err != nil {
+		return nil, err
+	}
+	seeded := dict.Keys(values)
+	slices.Sort(seeded)
+	return seeded, nil
+}
+
+// Startup check: optionally seeds the missing keys first,
+// then fails if there are missing keys or invalid values (orphaned keys are only logged)
+func EnsureNoDrift(rq *ze.Request, specs Specs, seed bool, updatedBy string) error {
+	if seed {
+		seeded, err := SeedDefaults(rq, specs, updatedBy)
+		if err != nil {
+			return err
+		}
+		if len(seeded) > 0 {
+			rq.AddFmtLog("Seeded config: %v", seeded)
+		}
+	}
+	drift, err := CheckDrift(rq, specs)
+	if err != nil {
+		return err
+	}
+	if len(drift.Orphaned) > 0 {
+		rq.AddFmtLog("Orphaned config: %v", drift.Orphaned)
+	}
+	if len(drift.Missing) > 0 || len(drift.Invalid) > 0 {
+		rq.Status = ze.Err500
+		return fmt.Errorf("%w: missing = %v, invalid = %v", errConfigDrift, drift.Missing, drift.Invalid)
+	}
+	return nil
+}
+
+// Root commands: config/drift, config/seed
+func DriftCommands(specs Specs, updatedBy string) []*root.CmdConfig {
+	return []*root.CmdConfig{
+		root.NewCommand("config/drift", 0, "Show missing, orphaned, and invalid config keys", func([]string) {
+			rq, err := newRequest("konfig.CheckDrift")
+			var drift *Drift
+			if err == nil {
+				drift, err = CheckDrift(rq, specs)
+			}
+			sys.DisplayData(drift, rq, err)
+		}),
+		root.NewCommand("config/seed", 0, "Insert missing config keys with their default values", func([]string) {
+			rq, err := ze.NewRequest("konfig.SeedDefaults")
+			var seeded []string
+			if err == nil {
+				seeded, err = SeedDefaults(rq, specs, updatedBy)
+			}
+			sys.DisplayData(&seeded, rq, err)
+		}),
+	}
+}
+
+// Add the specs of the keys in defaults map
+func addSpecs[V any](specs Specs, defaults map[string]V) {
+	for key, value := range defaults {
+		specs[key] = KeySpec{formatValue(value), true, reflect.TypeFor[V](), false}
+	}
+}
+
+// Convert value to config_app text, inverse of parseValue
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		if v.Year() == 0 {
+			return v.Format(timeFormats[2]) // time of day
+		}
+		return v.Format(timeFormats[0])
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice:
+		items := make([]string, rv.Len())
+		for i := range rv.Len() {
+			items[i] = formatValue(rv.Index(i).Interface())
+		}
+		return strings.Join(items, listGlue)
+	case reflect.Map:
+		items := make([]string, 0, rv.Len())
+		for _, key := range rv.MapKeys() {
+			items = append(items, formatValue(key.Interface())+mapGlue+formatValue(rv.MapIndex(key).Interface()))
+		}
+		slices.Sort(items)
+		return strings.Join(items, listGlue)
+	case reflect.Struct, reflect.Pointer:
+		text, _ := json.Marshal(value)
+		return string(text)
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,209 @@
+package konfig
+
+import (
+	"hash/fnv"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/krap/daemon"
+	"github.com/roidaradal/krap/sys"
+	"github.com/roidaradal/rdb/ze"
+)
+
+const fullRollout uint = 100
+
+var (
+	featureStore       atomic.Pointer[map[string]*Feature]        // Feature => Feature
+	scopedFeatureStore atomic.Pointer[map[string]map[string]bool] // Scope => Feature => IsActive
+)
+
+// Load all features from database into the cache
+func LoadFeatures(rq *ze.Request) error {
+	if FeatureSchema == nil {
+		return ze.ErrMissingSchema
+	}
+	items, err := FeatureSchema.GetAllRows(rq)
+	if err != nil {
+		rq.AddLog("Failed to load features from db")
+		return err
+	}
+	features := make(map[string]*Feature, len(items))
+	for _, item := range items {
+		features[item.Name] = item
+	}
+	featureStore.Store(&features)
+	return nil
+}
+
+// Load all scoped features from database into the cache
+func LoadScopedFeatures(rq *ze.Request) error {
+	if ScopedFeatureSchema == nil {
+		return ze.ErrMissingSchema
+	}
+	items, err := ScopedFeatureSchema.GetAllRows(rq)
+	if err != nil {
+		rq.AddLog("Failed to load scoped features from db")
+		return err
+	}
+	scoped := make(map[string]map[string]bool)
+	for _, item := range items {
+		if dict.NoKey(scoped, item.Scope) {
+			scoped[item.Scope] = make(map[string]bool)
+		}
+		scoped[item.Scope][item.Name] = item.IsActive
+	}
+	scopedFeatureStore.Store(&scoped)
+	return nil
+}
+
+// Runs a daemon that reloads the features and scoped features every given interval, returns the daemon handle;
+// features are stored in the DB, so reloads are skipped if there is no DB connection.
+// TimeScale = time.Hour, time.Minute, time.Second
+func WatchFeatures(interval int, timeScale time.Duration) *daemon.Handle {
+	return daemon.Run("konfig.Features", func() {
+		rq, err := newRequest("konfig.WatchFeatures")
+		if err == nil && rq.DB == nil {
+			return // DB-less setup: keep the cached features
+		}
+		if err == nil {
+			err = LoadFeatures(rq)
+		}
+		if err == nil {
+			err = LoadScopedFeatures(rq)
+		}
+		sys.DisplayResult(rq, err)
+	}, interval, timeScale)
+}
+
+// Get all cached features
+func GetAllFeatures() map[string]Feature {
+	features := make(map[string]Feature)
+	for name, feature := range getFeatures() {
+		features[name] = *feature
+	}
+	return features
+}
+
+// Get the sorted names of features that are currently on for everyone
+func GetActiveFeatures() []string {
+	now := clock.DateTimeNow()
+	active := make([]string, 0)
+	for name, feature := range getFeatures() {
+		if feature.isOn(now) && feature.rollout() >= fullRollout {
+			active = append(active, name)
+		}
+	}
+	slices.Sort(active)
+	return active
+}
+
+// Get all cached scoped features: Scope => Feature => IsActive
+func GetAllScopedFeatures() map[string]map[string]bool {
+	scoped := make(map[string]map[string]bool)
+	for scope, features := range getScopedFeatures() {
+		scoped[scope] = dict.Update(make(map[string]bool), features)
+	}
+	return scoped
+}
+
+// Get the sorted scopes that override the given feature
+func GetAllFeatureScopes(name string) []string {
+	scopes := make([]string, 0)
+	for scope, features := range getScopedFeatures() {
+		if dict.HasKey(features, name) {
+			scopes = append(scopes, scope)
+		}
+	}
+	slices.Sort(scopes)
+	return scopes
+}
+
+// Get the feature overrides of scope: Feature => IsActive
+func GetScopedFeatures(scope string) map[string]bool {
+	return dict.Update(make(map[string]bool), getScopedFeatures()[scope])
+}
+
+// Check if feature is active, within its date window, and fully rolled out
+func CheckFeature(name string) bool {
+	feature, ok := getFeatures()[name]
+	if !ok {
+		return false
+	}
+	return feature.isOn(clock.DateTimeNow()) && feature.rollout() >= fullRollout
+}
+
+// Check if feature is on for the given stable ID (e.g. account code):
+// feature must be active and within its date window, and the ID must fall in the rollout percentage
+func CheckFeatureFor(name, id string) bool {
+	feature, ok := getFeatures()[name]
+	if !ok || !feature.isOn(clock.DateTimeNow()) {
+		return false
+	}
+	return rolloutBucket(name, id) < feature.rollout()
+}
+
+// Check if feature is on for scope: the scope override replaces the feature's
+// IsActive flag and rollout, but the date window still applies
+func CheckScopedFeature(scope, name string) bool {
+	feature, ok := getFeatures()[name]
+	if !ok {
+		return false
+	}
+	isActive, ok := getScopedFeatures()[scope][name]
+	if !ok {
+		return CheckFeature(name)
+	}
+	return isActive && feature.inWindow(clock.DateTimeNow())
+}
+
+// Check if feature is active and now is within its StartAt-EndAt window
+func (f Feature) isOn(now ze.DateTime) bool {
+	return f.IsActive && f.inWindow(now)
+}
+
+// Get the rollout percentage, 0 = unset = full rollout
+func (f Feature) rollout() uint {
+	if f.Rollout == 0 {
+		return fullRollout
+	}
+	return f.Rollout
+}
+
+// Check if now is within the feature's StartAt-EndAt window (nil = unbounded)
+func (f Feature) inWindow(now ze.DateTime) bool {
+	if f.StartAt != nil && now < *f.StartAt {
+		return false
+	}
+	if f.EndAt != nil && now >= *f.EndAt {
+		return false
+	}
+	return true
+}
+
+// Stable rollout bucket [0, 100) of feature and ID
+func rolloutBucket(name, id string) uint {
+	h := fnv.New32a()
+	h.Write([]byte(name + keyGlue + id))
+	return uint(h.Sum32() % uint32(fullRollout))
+}
+
+// Get the cached features, empty if not yet loaded
+func getFeatures() map[string]*Feature {
+	features := featureStore.Load()
+	if features == nil {
+		return map[string]*Feature{}
+	}
+	return *features
+}
+
+// Get the cached scoped features, empty if not yet loaded
+func getScopedFeatures() map[string]map[string]bool {
+	scoped := scopedFeatureStore.Load()
+	if scoped == nil {
+		return map[string]map[string]bool{}
+	}
+	return *scoped
+}
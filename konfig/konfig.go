@@ -2,15 +2,14 @@
 package konfig
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/roidaradal/fn/dict"
-	"github.com/roidaradal/fn/dyn"
 	"github.com/roidaradal/fn/fail"
-	"github.com/roidaradal/fn/lang"
-	"github.com/roidaradal/fn/number"
-	"github.com/roidaradal/fn/str"
-	"github.com/roidaradal/rdb"
 	"github.com/roidaradal/rdb/ze"
 )
 
@@ -19,11 +18,17 @@ const (
 	listGlue string = "|"
 )
 
+var ErrInvalidConfig = errors.New("invalid config")
+
 // Initialize the config package
 func Initialize() error {
 	errs := make([]error, 0)
 
 	KVSchema = ze.AddSchema(&KV{}, "config_app", errs)
+	ScopedKVSchema = ze.AddSchema(&ScopedKV{}, "config_app_scoped", errs)
+	ChangeSchema = ze.AddSchema(&Change{}, "config_app_history", errs)
+	FeatureSchema = ze.AddSchema(&Feature{}, "config_features", errs)
+	ScopedFeatureSchema = ze.AddSchema(&ScopedFeature{}, "config_features_scoped", errs)
 
 	if len(errs) > 0 {
 		return fail.FromErrors("konfig.Initialize", errs)
@@ -32,79 +37,151 @@ func Initialize() error {
 	return nil
 }
 
-// Load Config lookup from database
+// Load Config lookup from the current KVStore (default: config_app table),
+// secret values are decrypted
 func Lookup(rq *ze.Request, appKeys []string) (dict.StringMap, error) {
-	if KVSchema == nil {
-		return nil, ze.ErrMissingSchema
+	lookup, err := CurrentKVStore().Lookup(rq, appKeys)
+	if err != nil {
+		return nil, err
+	}
+	err = decryptLookup(lookup)
+	if err != nil {
+		rq.AddErrorLog(err)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return lookup, nil
+}
+
+// Load Config lookup of all keys under the given domains, e.g. "Session" or "Session.*";
+// secret values are decrypted
+func LookupDomains(rq *ze.Request, domains ...string) (dict.StringMap, error) {
+	lookup, err := CurrentKVStore().PrefixLookup(rq, domainPrefixes(domains))
+	if err != nil {
+		return nil, err
 	}
-	kv := KVSchema.Ref
-	q := rdb.NewLookupQuery[KV](KVSchema.Table, &kv.Key, &kv.Value)
-	q.Where(rdb.In(&kv.Key, appKeys))
-	lookup, err := q.Lookup(rq.DB)
+	err = decryptLookup(lookup)
 	if err != nil {
-		rq.AddLog("Failed to load app config from db")
+		rq.AddErrorLog(err)
 		rq.Status = ze.Err500
 		return nil, err
 	}
 	return lookup, nil
 }
 
-// Decorates a Config object with the contents of lookup
-func Create[T any](cfg *T, lookup dict.StringMap, defaults *Defaults) *T {
-	for key := range defaults.UintMap {
-		value := uintOrDefault(lookup, defaults.UintMap, key)
-		dyn.SetFieldValue(cfg, getKey(key), value)
+// Get the sorted list of domains in the current KVStore:
+// the part of the keys before the first dot
+func Domains(rq *ze.Request) ([]string, error) {
+	lookup, err := CurrentKVStore().All(rq)
+	if err != nil {
+		return nil, err
 	}
-	for key := range defaults.IntMap {
-		value := intOrDefault(lookup, defaults.IntMap, key)
-		dyn.SetFieldValue(cfg, getKey(key), value)
+	domains := make([]string, 0)
+	for key := range lookup {
+		domain, _, ok := strings.Cut(key, keyGlue)
+		if ok && !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
 	}
-	for key := range defaults.StringMap {
-		value := stringOrDefault(lookup, defaults.StringMap, key)
-		dyn.SetFieldValue(cfg, getKey(key), value)
+	slices.Sort(domains)
+	return domains, nil
+}
+
+// Decorates a Config object with the contents of lookup.
+// Returns an error listing every key that failed to parse or failed its constraints
+func Create[T any](cfg *T, lookup dict.StringMap, defaults *Defaults) (*T, error) {
+	fe := newFieldErrors()
+	fillFields(cfg, lookup, defaults.UintMap, parseUint, fe)
+	fillFields(cfg, lookup, defaults.IntMap, parseInt, fe)
+	fillFields(cfg, lookup, defaults.FloatMap, parseFloat, fe)
+	fillFields(cfg, lookup, defaults.BoolMap, parseBool, fe)
+	fillFields(cfg, lookup, defaults.StringMap, parseString, fe)
+	fillFields(cfg, lookup, defaults.StringListMap, parseStringList, fe)
+	fillFields(cfg, lookup, defaults.StringMapMap, parseStringMap, fe)
+	fillFields(cfg, lookup, defaults.DurationMap, parseDuration, fe)
+	fillFields(cfg, lookup, defaults.TimeMap, parseTime, fe)
+	for key, defaultValue := range defaults.JSONMap {
+		path := fieldPath(cfg, key)
+		if err := checkSecretField(key, fieldByPath(cfg, path).Type()); err != nil {
+			fe.add(key, path, err)
+			continue
+		}
+		text, ok := lookup[key]
+		if !ok {
+			setFieldValue(cfg, path, defaultValue)
+			continue
+		}
+		value, err := parseJSON(text, fieldByPath(cfg, path).Type())
+		if err != nil {
+			fe.add(key, path, err)
+			continue
+		}
+		setFieldValue(cfg, path, value.Interface())
 	}
-	for key := range defaults.StringListMap {
-		value := stringListOrDefault(lookup, defaults.StringListMap, key)
-		dyn.SetFieldValue(cfg, getKey(key), value)
+	if err := fe.check(cfg); err != nil {
+		return nil, err
 	}
-	return cfg
+	return cfg, nil
 }
 
-// Extract the second part of <Domain>.<Key>
-func getKey(fullKey string) string {
-	parts := strings.Split(fullKey, keyGlue)
-	if len(parts) != 2 {
-		return fullKey
+// Fills the cfg fields of the keys in defaults,
+// using lookup[key] converted by parse, fallsback to defaults[key]
+func fillFields[V any](cfg any, lookup dict.StringMap, defaults map[string]V, parse func(string) (V, error), fe *fieldErrors) {
+	for key, defaultValue := range defaults {
+		path := fieldPath(cfg, key)
+		if err := checkSecretField(key, fieldByPath(cfg, path).Type()); err != nil {
+			fe.add(key, path, err)
+			continue
+		}
+		text, ok := lookup[key]
+		if !ok {
+			setFieldValue(cfg, path, defaultValue)
+			continue
+		}
+		value, err := parse(text)
+		if err != nil {
+			fe.add(key, path, err)
+			continue
+		}
+		setFieldValue(cfg, path, value)
 	}
-	return parts[1]
 }
 
-// Tries to convert lookup[key] to uint, fallsback to defaultValue[key]
-func uintOrDefault(lookup dict.StringMap, defaultValue map[string]uint, key string) uint {
-	value := defaultValue[key]
-	if lookupValue, ok := lookup[key]; ok {
-		value = uint(number.ParseInt(lookupValue))
+// Combines the list of errors into one ErrInvalidConfig error
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
 	}
-	return value
+	return fmt.Errorf("%w: %d errors encountered:\n%w", ErrInvalidConfig, len(errs), errors.Join(errs...))
 }
 
-// Tries to convert lookup[key] to int, fallsback to defaultValue[key]
-func intOrDefault(lookup dict.StringMap, defaultValue map[string]int, key string) int {
-	value := defaultValue[key]
-	if lookupValue, ok := lookup[key]; ok {
-		value = number.ParseInt(lookupValue)
+// Get the dotted struct field path of <Domain>.<Key>...:
+// if cfg has a <Domain> struct field, the key maps to nested fields from the root,
+// otherwise the domain is dropped (flat config) and the rest maps to nested fields
+func fieldPath(cfg any, fullKey string) string {
+	parts := strings.Split(fullKey, keyGlue)
+	if len(parts) > 1 {
+		structType := reflect.TypeOf(cfg).Elem()
+		domain, ok := structType.FieldByName(parts[0])
+		if !ok || domain.Type.Kind() != reflect.Struct {
+			parts = parts[1:]
+		}
 	}
-	return value
+	return strings.Join(parts, keyGlue)
 }
 
-// Tries to get lookup[key], fallsback to defaultValue[key]
-func stringOrDefault(lookup dict.StringMap, defaultValue dict.StringMap, key string) string {
-	value, ok := lookup[key]
-	return lang.Ternary(ok, value, defaultValue[key])
+// Get the cfg field at the dotted field path
+func fieldByPath(cfg any, path string) reflect.Value {
+	value := reflect.ValueOf(cfg).Elem()
+	for _, name := range strings.Split(path, keyGlue) {
+		value = value.FieldByName(name)
+	}
+	return value
 }
 
-// Tries to convert lookup[key] to []string, fallsback to defaultValue[key]
-func stringListOrDefault(lookup dict.StringMap, defaultValue dict.StringListMap, key string) []string {
-	value, ok := lookup[key]
-	return lang.Ternary(ok, str.CleanSplit(value, listGlue), defaultValue[key])
+// Set the cfg field at the dotted field path,
+// converting value to named field types, e.g. string to sys.Secret
+func setFieldValue(cfg any, path string, value any) {
+	field := fieldByPath(cfg, path)
+	field.Set(reflect.ValueOf(value).Convert(field.Type()))
 }
@@ -0,0 +1,294 @@
+package konfig
+
+import (
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/rdb"
+	"github.com/roidaradal/rdb/ze"
+)
+
+// Storage of config key-values, used by the read APIs: Lookup, LookupDomains, Domains,
+// Load, ScopedLookup, Store, CheckDrift, ListConfig, Export;
+// file and memory stores ignore the request's DB connection, so the watchers
+// and root commands of the read APIs also run without a DB.
+// Writes and history are DB-only: Set, SetMany, Delete, Rollback, History, Import,
+// SeedDefaults, RotateSecrets, KeyScopes
+type KVStore interface {
+	// Get the stored values of the given keys, missing keys are skipped
+	Lookup(rq *ze.Request, keys []string) (dict.StringMap, error)
+	// Get the stored values of the keys that start with any of the prefixes
+	PrefixLookup(rq *ze.Request, prefixes []string) (dict.StringMap, error)
+	// Get all stored key-values
+	All(rq *ze.Request) (dict.StringMap, error)
+}
+
+// KVStore with scope-specific overrides, used by ScopedLookup;
+// for stores without scopes, ScopedLookup returns the global values
+type ScopedKVStore interface {
+	KVStore
+	// Get the scope's override values of the given keys, missing keys are skipped
+	ScopedLookup(rq *ze.Request, scope string, keys []string) (dict.StringMap, error)
+}
+
+var (
+	_ ScopedKVStore = DBStore{}
+	_ KVStore       = (*FileStore)(nil)
+	_ ScopedKVStore = (*MemoryStore)(nil)
+)
+
+var (
+	kvStoreMu sync.RWMutex
+	kvStore   KVStore = DBStore{}
+)
+
+// Set the KVStore used by Lookup, default is DBStore
+func SetKVStore(store KVStore) {
+	kvStoreMu.Lock()
+	defer kvStoreMu.Unlock()
+	kvStore = store
+}
+
+// Get the KVStore used by Lookup
+func CurrentKVStore() KVStore {
+	kvStoreMu.RLock()
+	defer kvStoreMu.RUnlock()
+	return kvStore
+}
+
+// Create request for the read APIs: if there is no DB connection and the current KVStore
+// is not a DBStore, returns a request without DB connection instead of an error,
+// so that file and memory stores work without a DB
+func newRequest(name string, args ...any) (*ze.Request, error) {
+	rq, err := ze.NewRequest(name, args...)
+	if _, isDB := CurrentKVStore().(DBStore); err != nil && !isDB {
+		rq.Status = ze.OK200
+		return rq, nil
+	}
+	return rq, err
+}
+
+// KVStore backed by the config_app table
+type DBStore struct{}
+
+// Load config_app values of the given keys
+func (DBStore) Lookup(rq *ze.Request, keys []string) (dict.StringMap, error) {
+	if KVSchema == nil {
+		return nil, ze.ErrMissingSchema
+	}
+	kv := KVSchema.Ref
+	q := rdb.NewLookupQuery[KV](KVSchema.Table, &kv.Key, &kv.Value)
+	q.Where(rdb.In(&kv.Key, keys))
+	lookup, err := q.Lookup(rq.DB)
+	if err != nil {
+		rq.AddLog("Failed to load app config from db")
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return lookup, nil
+}
+
+// Load config_app values of the keys that start with any of the prefixes
+func (DBStore) PrefixLookup(rq *ze.Request, prefixes []string) (dict.StringMap, error) {
+	if KVSchema == nil {
+		return nil, ze.ErrMissingSchema
+	}
+	kv := KVSchema.Ref
+	conditions := make([]rdb.Condition, len(prefixes))
+	for i, prefix := range prefixes {
+		conditions[i] = rdb.Prefix(&kv.Key, prefix)
+	}
+	q := rdb.NewLookupQuery[KV](KVSchema.Table, &kv.Key, &kv.Value)
+	q.Where(rdb.Or(conditions...))
+	lookup, err := q.Lookup(rq.DB)
+	if err != nil {
+		rq.AddFmtLog("Failed to load app config %v from db", prefixes)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return pickPrefixes(lookup, prefixes), nil // LIKE treats _ as wildcard
+}
+
+// Load all config_app values
+func (DBStore) All(rq *ze.Request) (dict.StringMap, error) {
+	if KVSchema == nil {
+		return nil, ze.ErrMissingSchema
+	}
+	rows, err := KVSchema.GetAllRows(rq)
+	if err != nil {
+		rq.AddLog("Failed to load app config from db")
+		return nil, err
+	}
+	lookup := make(dict.StringMap, len(rows))
+	for _, row := range rows {
+		lookup[row.Key] = row.Value
+	}
+	return lookup, nil
+}
+
+// Load config_app_scoped values of scope for the given keys
+func (DBStore) ScopedLookup(rq *ze.Request, scope string, keys []string) (dict.StringMap, error) {
+	if ScopedKVSchema == nil {
+		return nil, ze.ErrMissingSchema
+	}
+	kv := ScopedKVSchema.Ref
+	q := rdb.NewLookupQuery[ScopedKV](ScopedKVSchema.Table, &kv.Key, &kv.Value)
+	q.Where(rdb.And(
+		rdb.Equal(&kv.Scope, scope),
+		rdb.In(&kv.Key, keys),
+	))
+	lookup, err := q.Lookup(rq.DB)
+	if err != nil {
+		rq.AddFmtLog("Failed to load app config of scope %s from db", scope)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return lookup, nil
+}
+
+// KVStore backed by a JSON or YAML file (same format as FileSource),
+// the file is read on every lookup so edits are picked up
+type FileStore struct {
+	Path string
+}
+
+// Create new FileStore
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load file values of the given keys
+func (s *FileStore) Lookup(rq *ze.Request, keys []string) (dict.StringMap, error) {
+	all, err := s.All(rq)
+	if err != nil {
+		return nil, err
+	}
+	return pickKeys(all, keys), nil
+}
+
+// Load file values of the keys that start with any of the prefixes
+func (s *FileStore) PrefixLookup(rq *ze.Request, prefixes []string) (dict.StringMap, error) {
+	all, err := s.All(rq)
+	if err != nil {
+		return nil, err
+	}
+	return pickPrefixes(all, prefixes), nil
+}
+
+// Load all file values
+func (s *FileStore) All(rq *ze.Request) (dict.StringMap, error) {
+	lookup, err := readConfigFile(s.Path)
+	if err != nil {
+		rq.AddFmtLog("Failed to load app config from %s", s.Path)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return lookup, nil
+}
+
+// In-memory KVStore with scoped overrides, safe for concurrent use
+type MemoryStore struct {
+	mu     sync.RWMutex
+	lookup dict.StringMap
+	scoped map[string]dict.StringMap // Scope => Key => Value
+}
+
+// Create new MemoryStore with initial values
+func NewMemoryStore(lookup dict.StringMap) *MemoryStore {
+	s := &MemoryStore{
+		lookup: make(dict.StringMap, len(lookup)),
+		scoped: make(map[string]dict.StringMap),
+	}
+	maps.Copy(s.lookup, lookup)
+	return s
+}
+
+// Get stored values of the given keys
+func (s *MemoryStore) Lookup(rq *ze.Request, keys []string) (dict.StringMap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return pickKeys(s.lookup, keys), nil
+}
+
+// Get stored values of the keys that start with any of the prefixes
+func (s *MemoryStore) PrefixLookup(rq *ze.Request, prefixes []string) (dict.StringMap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return pickPrefixes(s.lookup, prefixes), nil
+}
+
+// Get all stored values
+func (s *MemoryStore) All(rq *ze.Request) (dict.StringMap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.lookup), nil
+}
+
+// Get stored override values of scope for the given keys
+func (s *MemoryStore) ScopedLookup(rq *ze.Request, scope string, keys []string) (dict.StringMap, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return pickKeys(s.scoped[scope], keys), nil
+}
+
+// Set the override value of config key for scope
+func (s *MemoryStore) SetScoped(scope, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dict.NoKey(s.scoped, scope) {
+		s.scoped[scope] = make(dict.StringMap)
+	}
+	s.scoped[scope][key] = value
+}
+
+// Delete the override values of config keys for scope
+func (s *MemoryStore) DeleteScoped(scope string, keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.scoped[scope], key)
+	}
+}
+
+// Set the value of config key
+func (s *MemoryStore) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookup[key] = value
+}
+
+// Delete the config keys
+func (s *MemoryStore) Delete(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.lookup, key)
+	}
+}
+
+// Get the values of the given keys found in lookup
+func pickKeys(lookup dict.StringMap, keys []string) dict.StringMap {
+	picked := make(dict.StringMap, len(keys))
+	for _, key := range keys {
+		if value, ok := lookup[key]; ok {
+			picked[key] = value
+		}
+	}
+	return picked
+}
+
+// Get the values of the keys in lookup that start with any of the prefixes
+func pickPrefixes(lookup dict.StringMap, prefixes []string) dict.StringMap {
+	picked := make(dict.StringMap)
+	for key, value := range lookup {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				picked[key] = value
+				break
+			}
+		}
+	}
+	return picked
+}
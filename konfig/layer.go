@@ -0,0 +1,228 @@
+package konfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/fn/str"
+	"github.com/roidaradal/rdb/ze"
+)
+
+// Config source layer
+type Layer = string
+
+const (
+	LayerDefault Layer = "default" // struct default tags
+	LayerFile    Layer = "file"    // JSON / YAML file
+	LayerDB      Layer = "db"      // config_app table
+	LayerEnv     Layer = "env"     // environment variables
+	LayerFlag    Layer = "flag"    // command-line flags
+)
+
+// Layer precedence, lowest first: a key in a later layer overrides earlier layers
+var layerOrder = []Layer{LayerDefault, LayerFile, LayerDB, LayerEnv, LayerFlag}
+
+const flagPrefix string = "--"
+
+// Config values supplied by one layer
+type Source struct {
+	Layer  Layer
+	Lookup dict.StringMap
+}
+
+// Effective config value and the layer that supplied it
+type Resolved struct {
+	Value string
+	Layer Layer
+}
+
+// Options for LoadLayers; blank FilePath skips the file layer,
+// nil Request skips the db layer, nil Args skips the flag layer
+type LayerOptions struct {
+	Request   *ze.Request
+	FilePath  string
+	EnvPrefix string
+	Args      []string
+}
+
+// Merge sources following the layer precedence, regardless of the order given
+func Resolve(sources ...Source) map[string]Resolved {
+	sources = slices.Clone(sources)
+	slices.SortStableFunc(sources, func(a, b Source) int {
+		return slices.Index(layerOrder, a.Layer) - slices.Index(layerOrder, b.Layer)
+	})
+	resolved := make(map[string]Resolved)
+	for _, source := range sources {
+		for key, value := range source.Lookup {
+			resolved[key] = Resolved{Value: value, Layer: source.Layer}
+		}
+	}
+	return resolved
+}
+
+// Get the effective values of resolved config
+func ResolvedLookup(resolved map[string]Resolved) dict.StringMap {
+	lookup := make(dict.StringMap, len(resolved))
+	for key, item := range resolved {
+		lookup[key] = item.Value
+	}
+	return lookup
+}
+
+// Load config T from all layers, returns the config and the resolved value of each key
+func LoadLayers[T any](opts *LayerOptions) (*T, map[string]Resolved, error) {
+	keys := Keys[T]()
+	sources := []Source{DefaultSource[T]()}
+	if opts.FilePath != "" {
+		source, err := FileSource(opts.FilePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, source)
+	}
+	if opts.Request != nil {
+		source, err := DBSource(opts.Request, keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, source)
+	}
+	sources = append(sources, EnvSource(opts.EnvPrefix, keys))
+	if opts.Args != nil {
+		sources = append(sources, FlagSource(opts.Args, keys))
+	}
+	resolved := Resolve(sources...)
+	cfg, err := Bind(new(T), ResolvedLookup(resolved))
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, resolved, nil
+}
+
+// Default layer: the default tags of config T
+func DefaultSource[T any]() Source {
+	lookup := make(dict.StringMap)
+	for _, f := range fieldsOf[T]() {
+		if f.HasDefault {
+			lookup[f.Key] = f.Default
+		}
+	}
+	return Source{Layer: LayerDefault, Lookup: lookup}
+}
+
+// File layer: JSON or YAML file (by extension), containing either
+// flat {"<Domain>.<Key>": value} entries or nested {"<Domain>": {"<Key>": value}} objects
+func FileSource(path string) (Source, error) {
+	lookup, err := readConfigFile(path)
+	if err != nil {
+		return Source{}, err
+	}
+	return Source{Layer: LayerFile, Lookup: lookup}, nil
+}
+
+// DB layer: values of the given keys from the current KVStore
+func DBSource(rq *ze.Request, keys []string) (Source, error) {
+	lookup, err := Lookup(rq, keys)
+	if err != nil {
+		return Source{}, err
+	}
+	return Source{Layer: LayerDB, Lookup: lookup}, nil
+}
+
+// Env layer: <PREFIX>_<DOMAIN>_<KEY> environment variables of the given keys
+func EnvSource(prefix string, keys []string) Source {
+	lookup := make(dict.StringMap)
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(EnvName(prefix, key)); ok {
+			lookup[key] = value
+		}
+	}
+	return Source{Layer: LayerEnv, Lookup: lookup}
+}
+
+// Flag layer: --<Domain>.<Key>=<value> arguments of the given keys
+func FlagSource(args []string, keys []string) Source {
+	lookup := make(dict.StringMap)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, flagPrefix) {
+			continue
+		}
+		parts := str.CleanSplitN(strings.TrimPrefix(arg, flagPrefix), "=", 2)
+		if len(parts) != 2 || !slices.Contains(keys, parts[0]) {
+			continue
+		}
+		lookup[parts[0]] = parts[1]
+	}
+	return Source{Layer: LayerFlag, Lookup: lookup}
+}
+
+// Environment variable name of config key: Session.Duration => <PREFIX>_SESSION_DURATION
+func EnvName(prefix, key string) string {
+	name := strings.ToUpper(strings.ReplaceAll(key, keyGlue, "_"))
+	if prefix == "" {
+		return name
+	}
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// Read JSON or YAML config file (by extension) into flat <Domain>.<Key> => value text
+func readConfigFile(path string) (dict.StringMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var content map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &content)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber() // keep large numbers as is
+		err = decoder.Decode(&content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	lookup := make(dict.StringMap)
+	flattenInto(lookup, "", content)
+	return lookup, nil
+}
+
+// Flatten nested file content into <Domain>.<Key> => value text
+func flattenInto(lookup dict.StringMap, prefix string, content map[string]any) {
+	for name, value := range content {
+		key := name
+		if prefix != "" {
+			key = prefix + keyGlue + name
+		}
+		if nested, ok := value.(map[string]any); ok {
+			flattenInto(lookup, key, nested)
+			continue
+		}
+		lookup[key] = fileValueText(value)
+	}
+}
+
+// Convert file value to config_app text: lists are joined by listGlue
+func fileValueText(value any) string {
+	if value == nil {
+		return ""
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice {
+		items := make([]string, rv.Len())
+		for i := range rv.Len() {
+			items[i] = fmt.Sprintf("%v", rv.Index(i).Interface())
+		}
+		return strings.Join(items, listGlue)
+	}
+	return fmt.Sprintf("%v", value)
+}
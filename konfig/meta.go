@@ -0,0 +1,139 @@
+package konfig
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/fn/ds"
+	"github.com/roidaradal/krap/root"
+	"github.com/roidaradal/krap/sys"
+	"github.com/roidaradal/rdb/ze"
+)
+
+const (
+	docTag     string = "doc"     // description of config key
+	unitTag    string = "unit"    // unit of config value, e.g. seconds, MB
+	restartTag string = "restart" // app must be restarted to apply changes
+)
+
+// Documentation of config key
+type KeyMeta struct {
+	Key             string
+	Description     string
+	Type            string
+	Unit            string
+	Default         string
+	Min             string
+	Max             string
+	IsSecret        bool
+	RequiresRestart bool
+}
+
+// Config key documentation with its current value
+type KeyInfo struct {
+	KeyMeta
+	Value string
+	IsSet bool // key is in config
+}
+
+var registry = dict.NewSyncMap[string, KeyMeta]()
+
+// Register the documentation of config keys; secret keys are also registered as secrets
+func Register(metas ...KeyMeta) {
+	for _, meta := range metas {
+		registry.Set(meta.Key, meta)
+		if meta.IsSecret {
+			RegisterSecrets(meta.Key)
+		}
+	}
+}
+
+// Register the documentation of the konfig-tagged fields of T,
+// using the doc, unit, restart, default, min, max, and secret tags
+func RegisterOf[T any]() {
+	RegisterSecretsOf[T]()
+	structType := reflect.TypeFor[T]()
+	for _, f := range fieldsOf[T]() {
+		tag := structType.FieldByIndex(f.Index).Tag
+		Register(KeyMeta{
+			Key:             f.Key,
+			Description:     tag.Get(docTag),
+			Type:            f.Type.String(),
+			Unit:            tag.Get(unitTag),
+			Default:         f.Default,
+			Min:             tag.Get(minTag),
+			Max:             tag.Get(maxTag),
+			IsSecret:        IsSecret(f.Key),
+			RequiresRestart: tag.Get(restartTag) == "true",
+		})
+	}
+}
+
+// Get the documentation of config key
+func Meta(key string) (KeyMeta, bool) {
+	return registry.Get(key)
+}
+
+// Get the documentation of all registered keys, sorted by key
+func Registry() []KeyMeta {
+	metas := make([]KeyMeta, 0)
+	for _, key := range registeredKeys() {
+		if meta, ok := registry.Get(key); ok {
+			metas = append(metas, meta)
+		}
+	}
+	return metas
+}
+
+// Get the registered keys of the given domains (all if none) with their current values,
+// sorted by key; secret values are redacted
+func ListConfig(rq *ze.Request, domains ...string) ([]*KeyInfo, error) {
+	metas := Registry()
+	if len(domains) > 0 {
+		prefixes := domainPrefixes(domains)
+		metas = slices.DeleteFunc(metas, func(meta KeyMeta) bool {
+			return !slices.ContainsFunc(prefixes, func(prefix string) bool {
+				return strings.HasPrefix(meta.Key, prefix)
+			})
+		})
+	}
+	keys := make([]string, len(metas))
+	for i, meta := range metas {
+		keys[i] = meta.Key
+	}
+	lookup, err := Lookup(rq, keys)
+	if err != nil {
+		return nil, err
+	}
+	lookup = Redact(lookup)
+	infos := make([]*KeyInfo, len(metas))
+	for i, meta := range metas {
+		value, isSet := lookup[meta.Key]
+		if meta.IsSecret && meta.Default != "" {
+			meta.Default = sys.RedactedText
+		}
+		infos[i] = &KeyInfo{KeyMeta: meta, Value: value, IsSet: isSet}
+	}
+	return infos, nil
+}
+
+// Root command: config/list [DOMAINS...]
+func ListCommand() *root.CmdConfig {
+	return root.NewCommand("config/list", 0, "[DOMAINS...] List config keys with their current value, default, and docs", func(params []string) {
+		rq, err := newRequest("konfig.ListConfig")
+		var infos []*KeyInfo
+		if err == nil {
+			infos, err = ListConfig(rq, params...)
+		}
+		sys.DisplayList(ds.NewList(infos), rq, err)
+	})
+}
+
+// Get the sorted list of registered keys
+func registeredKeys() []string {
+	keys := registry.Keys()
+	slices.Sort(keys)
+	return keys
+}
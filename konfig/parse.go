@@ -0,0 +1,225 @@
+package konfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/fn/str"
+)
+
+const mapGlue string = ":"
+
+var (
+	errInvalidValue    = errors.New("invalid value")
+	errUnsupportedType = errors.New("unsupported type")
+)
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	timeType     = reflect.TypeFor[time.Time]()
+)
+
+// Accepted formats for time.Time config values
+var timeFormats = []string{
+	"2006-01-02 15:04:05", // datetime
+	"2006-01-02",          // date
+	"15:04:05",            // time of day
+	"15:04",               // hour:min
+}
+
+// Convert config_app text value to the given type:
+// numbers, bool, string, time.Duration ("15m"), time.Time (datetime, date, or time of day),
+// lists ("a|b|c"), maps ("k1:v1|k2:v2" or JSON object), and JSON-encoded structs
+func parseValue(text string, t reflect.Type) (reflect.Value, error) {
+	switch t {
+	case durationType:
+		return convert(parseDuration(text))
+	case timeType:
+		return convert(parseTime(text))
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(strings.TrimSpace(text), 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%w: %q is not an int", errInvalidValue, text)
+		}
+		return reflect.ValueOf(value).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(strings.TrimSpace(text), 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%w: %q is not a uint", errInvalidValue, text)
+		}
+		return reflect.ValueOf(value).Convert(t), nil
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(strings.TrimSpace(text), t.Bits())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%w: %q is not a float", errInvalidValue, text)
+		}
+		return reflect.ValueOf(value).Convert(t), nil
+	case reflect.Bool:
+		value, err := parseBool(text)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(value).Convert(t), nil
+	case reflect.String:
+		return reflect.ValueOf(text).Convert(t), nil
+	case reflect.Slice:
+		return parseList(text, t)
+	case reflect.Map:
+		return parseMap(text, t)
+	case reflect.Struct, reflect.Pointer:
+		return parseJSON(text, t)
+	}
+	return reflect.Value{}, fmt.Errorf("%w: %s", errUnsupportedType, t)
+}
+
+// Parse uint value, rejects negative numbers
+func parseUint(text string) (uint, error) {
+	value, err := strconv.ParseUint(strings.TrimSpace(text), 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a uint", errInvalidValue, text)
+	}
+	return uint(value), nil
+}
+
+// Parse int value
+func parseInt(text string) (int, error) {
+	value, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not an int", errInvalidValue, text)
+	}
+	return value, nil
+}
+
+// Parse float64 value
+func parseFloat(text string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a float", errInvalidValue, text)
+	}
+	return value, nil
+}
+
+// Parse bool value: 1, t, true, 0, f, false (any case)
+func parseBool(text string) (bool, error) {
+	value, err := strconv.ParseBool(strings.TrimSpace(text))
+	if err != nil {
+		return false, fmt.Errorf("%w: %q is not a bool", errInvalidValue, text)
+	}
+	return value, nil
+}
+
+// Parse time.Duration value, e.g. 90s, 15m, 1h30m
+func parseDuration(text string) (time.Duration, error) {
+	value, err := time.ParseDuration(strings.TrimSpace(text))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a duration", errInvalidValue, text)
+	}
+	return value, nil
+}
+
+// Parse time.Time value in the current timezone, using one of the timeFormats
+func parseTime(text string) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	for _, format := range timeFormats {
+		value, err := time.ParseInLocation(format, text, clock.CurrentTimezone())
+		if err == nil {
+			return value, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is not a datetime, date, or time", errInvalidValue, text)
+}
+
+// Return text as is
+func parseString(text string) (string, error) {
+	return text, nil
+}
+
+// Split text by listGlue into []string
+func parseStringList(text string) ([]string, error) {
+	return splitList(text), nil
+}
+
+// Parse "k1:v1|k2:v2" into map[string]string
+func parseStringMap(text string) (map[string]string, error) {
+	value, err := parseMap(text, reflect.TypeFor[map[string]string]())
+	if err != nil {
+		return nil, err
+	}
+	return value.Interface().(map[string]string), nil
+}
+
+// Parse list of items separated by listGlue, each item converted to the list's element type
+func parseList(text string, t reflect.Type) (reflect.Value, error) {
+	items := splitList(text)
+	list := reflect.MakeSlice(t, len(items), len(items))
+	for i, item := range items {
+		value, err := parseValue(item, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		list.Index(i).Set(value)
+	}
+	return list, nil
+}
+
+// Parse JSON object, or key:value pairs separated by listGlue
+func parseMap(text string, t reflect.Type) (reflect.Value, error) {
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		return parseJSON(text, t)
+	}
+	items := splitList(text)
+	lookup := reflect.MakeMapWithSize(t, len(items))
+	for _, item := range items {
+		parts := str.CleanSplitN(item, mapGlue, 2)
+		if len(parts) != 2 {
+			return reflect.Value{}, fmt.Errorf("%w: %q is not a key%svalue pair", errInvalidValue, item, mapGlue)
+		}
+		key, err := parseValue(parts[0], t.Key())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value, err := parseValue(parts[1], t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		lookup.SetMapIndex(key, value)
+	}
+	return lookup, nil
+}
+
+// Parse JSON-encoded text into a new value of the given type
+func parseJSON(text string, t reflect.Type) (reflect.Value, error) {
+	ref := reflect.New(t)
+	if strings.TrimSpace(text) == "" {
+		return ref.Elem(), nil
+	}
+	err := json.Unmarshal([]byte(text), ref.Interface())
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("%w: invalid JSON: %w", errInvalidValue, err)
+	}
+	return ref.Elem(), nil
+}
+
+// Split text by listGlue, blank text results to empty list
+func splitList(text string) []string {
+	if strings.TrimSpace(text) == "" {
+		return []string{}
+	}
+	return str.CleanSplit(text, listGlue)
+}
+
+// Wrap typed parse result as reflect.Value
+func convert[T any](value T, err error) (reflect.Value, error) {
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(value), nil
+}
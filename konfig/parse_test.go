@@ -0,0 +1,78 @@
+package konfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+)
+
+type testLimits struct {
+	Max  int
+	Tags []string
+}
+
+type testLevel uint8
+
+func TestParseValue(t *testing.T) {
+	tz := clock.CurrentTimezone()
+	testCases := []struct {
+		name string
+		text string
+		typ  reflect.Type
+		want any // nil = error
+	}{
+		{"int", " -42 ", reflect.TypeFor[int](), -42},
+		{"int overflow", "300", reflect.TypeFor[int8](), nil},
+		{"int invalid", "4x", reflect.TypeFor[int](), nil},
+		{"uint", "42", reflect.TypeFor[uint](), uint(42)},
+		{"uint negative", "-1", reflect.TypeFor[uint](), nil},
+		{"named uint", "3", reflect.TypeFor[testLevel](), testLevel(3)},
+		{"float", "2.5", reflect.TypeFor[float64](), 2.5},
+		{"float invalid", "2,5", reflect.TypeFor[float64](), nil},
+		{"bool", "TRUE", reflect.TypeFor[bool](), true},
+		{"bool short", "f", reflect.TypeFor[bool](), false},
+		{"bool invalid", "yes", reflect.TypeFor[bool](), nil},
+		{"string", " keep spaces ", reflect.TypeFor[string](), " keep spaces "},
+		{"duration", "1h30m", reflect.TypeFor[time.Duration](), 90 * time.Minute},
+		{"duration without unit", "15", reflect.TypeFor[time.Duration](), nil},
+		{"datetime", "2026-03-01 08:30:00", reflect.TypeFor[time.Time](), time.Date(2026, 3, 1, 8, 30, 0, 0, tz)},
+		{"date", "2026-03-01", reflect.TypeFor[time.Time](), time.Date(2026, 3, 1, 0, 0, 0, 0, tz)},
+		{"hour:min", "08:30", reflect.TypeFor[time.Time](), time.Date(0, 1, 1, 8, 30, 0, 0, tz)},
+		{"time invalid", "tomorrow", reflect.TypeFor[time.Time](), nil},
+		{"string list", "a | b|c", reflect.TypeFor[[]string](), []string{"a", "b", "c"}},
+		{"blank list", " ", reflect.TypeFor[[]string](), []string{}},
+		{"int list", "1|2|3", reflect.TypeFor[[]int](), []int{1, 2, 3}},
+		{"int list invalid item", "1|two", reflect.TypeFor[[]int](), nil},
+		{"map pairs", "a:1|b:2", reflect.TypeFor[map[string]int](), map[string]int{"a": 1, "b": 2}},
+		{"map value with glue", "url:http://x", reflect.TypeFor[map[string]string](), map[string]string{"url": "http://x"}},
+		{"map json", `{"a": 1}`, reflect.TypeFor[map[string]int](), map[string]int{"a": 1}},
+		{"map invalid pair", "a", reflect.TypeFor[map[string]string](), nil},
+		{"struct json", `{"Max": 5, "Tags": ["x"]}`, reflect.TypeFor[testLimits](), testLimits{Max: 5, Tags: []string{"x"}}},
+		{"struct blank", "", reflect.TypeFor[testLimits](), testLimits{}},
+		{"struct invalid json", `{"Max": "five"}`, reflect.TypeFor[testLimits](), nil},
+		{"pointer json", `{"Max": 5}`, reflect.TypeFor[*testLimits](), &testLimits{Max: 5}},
+		{"unsupported", "1", reflect.TypeFor[chan int](), nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseValue(tc.text, tc.typ)
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("parseValue(%q, %s) = %v, want error", tc.text, tc.typ, got)
+				} else if !errors.Is(err, errInvalidValue) && !errors.Is(err, errUnsupportedType) {
+					t.Errorf("parseValue(%q, %s) error = %v, want errInvalidValue or errUnsupportedType", tc.text, tc.typ, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseValue(%q, %s) error: %v", tc.text, tc.typ, err)
+			}
+			if !reflect.DeepEqual(got.Interface(), tc.want) {
+				t.Errorf("parseValue(%q, %s) = %#v, want %#v", tc.text, tc.typ, got.Interface(), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package konfig
+
+import (
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/rdb"
+	"github.com/roidaradal/rdb/ze"
+)
+
+// Load scoped config lookup from the current KVStore (default: config_app, config_app_scoped):
+// the scope value overrides the global value of each key, secret values are decrypted.
+// For stores without scopes (see ScopedKVStore), returns the global values
+func ScopedLookup(rq *ze.Request, scope string, appKeys []string) (dict.StringMap, error) {
+	lookup, err := Lookup(rq, appKeys)
+	if err != nil {
+		return nil, err
+	}
+	store, ok := CurrentKVStore().(ScopedKVStore)
+	if !ok {
+		return lookup, nil
+	}
+	scopedLookup, err := store.ScopedLookup(rq, scope, appKeys)
+	if err != nil {
+		return nil, err
+	}
+	err = decryptLookup(scopedLookup)
+	if err != nil {
+		rq.AddErrorLog(err)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return dict.Update(lookup, scopedLookup), nil
+}
+
+// Load config T for scope, using the keys declared in its konfig tags:
+// resolves scope value => global value => default tag
+func LoadScoped[T any](rq *ze.Request, scope string) (*T, error) {
+	lookup, err := ScopedLookup(rq, scope, Keys[T]())
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Bind(new(T), lookup)
+	if err != nil {
+		rq.AddErrorLog(err)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Decorates a Config object for scope, using the keys in defaults:
+// resolves scope value => global value => defaults
+func CreateScoped[T any](rq *ze.Request, cfg *T, scope string, defaults *Defaults) (*T, error) {
+	lookup, err := ScopedLookup(rq, scope, defaults.Keys())
+	if err != nil {
+		return nil, err
+	}
+	cfg, err = Create(cfg, lookup, defaults)
+	if err != nil {
+		rq.AddErrorLog(err)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Get the scopes that override the given key
+func KeyScopes(rq *ze.Request, key string) ([]string, error) {
+	if ScopedKVSchema == nil {
+		return nil, ze.ErrMissingSchema
+	}
+	kv := ScopedKVSchema.Ref
+	q := rdb.NewDistinctValuesQuery[ScopedKV](ScopedKVSchema.Table, &kv.Scope)
+	q.Where(rdb.Equal(&kv.Key, key))
+	scopes, err := q.Query(rq.DB)
+	if err != nil {
+		rq.AddFmtLog("Failed to load scopes of %s", key)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	return scopes, nil
+}
@@ -0,0 +1,87 @@
+package konfig
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/rdb/ze"
+)
+
+func TestScopedLookup(t *testing.T) {
+	store := useMemoryStore(t, dict.StringMap{
+		"Billing.DueDays":  "30",
+		"Billing.Currency": "USD",
+		"Billing.Grace":    "3",
+	})
+	store.SetScoped("acme", "Billing.DueDays", "45")
+	store.SetScoped("acme", "Billing.Region", "EU")
+	store.SetScoped("other", "Billing.Currency", "JPY")
+	keys := []string{"Billing.DueDays", "Billing.Currency", "Billing.Region", "Billing.Missing"}
+	testCases := []struct {
+		name  string
+		scope string
+		want  dict.StringMap
+	}{
+		{"scope overrides global", "acme", dict.StringMap{"Billing.DueDays": "45", "Billing.Currency": "USD", "Billing.Region": "EU"}},
+		{"other scope", "other", dict.StringMap{"Billing.DueDays": "30", "Billing.Currency": "JPY"}},
+		{"unknown scope", "nobody", dict.StringMap{"Billing.DueDays": "30", "Billing.Currency": "USD"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ScopedLookup(newTestRequest(t), tc.scope, keys)
+			if err != nil {
+				t.Fatalf("ScopedLookup error: %v", err)
+			}
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("ScopedLookup(%s) = %v, want %v", tc.scope, got, tc.want)
+			}
+		})
+	}
+
+	// Lookup only reads global values
+	got, err := Lookup(newTestRequest(t), keys)
+	if err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	want := dict.StringMap{"Billing.DueDays": "30", "Billing.Currency": "USD"}
+	if !maps.Equal(got, want) {
+		t.Errorf("Lookup = %v, want %v", got, want)
+	}
+}
+
+func TestScopedLookupWithoutScopes(t *testing.T) {
+	SetKVStore(globalOnlyStore{NewMemoryStore(dict.StringMap{"Billing.DueDays": "30"})})
+	t.Cleanup(func() { SetKVStore(DBStore{}) })
+	got, err := ScopedLookup(newTestRequest(t), "acme", []string{"Billing.DueDays"})
+	if err != nil {
+		t.Fatalf("ScopedLookup error: %v", err)
+	}
+	if got["Billing.DueDays"] != "30" {
+		t.Errorf("ScopedLookup = %v, want global value", got)
+	}
+}
+
+// KVStore without scoped overrides
+type globalOnlyStore struct {
+	KVStore
+}
+
+// Use a MemoryStore with the given values as the current KVStore for the test
+func useMemoryStore(t *testing.T, lookup dict.StringMap) *MemoryStore {
+	t.Helper()
+	store := NewMemoryStore(lookup)
+	SetKVStore(store)
+	t.Cleanup(func() { SetKVStore(DBStore{}) })
+	return store
+}
+
+// Create a request without DB connection, for non-DB stores
+func newTestRequest(t *testing.T) *ze.Request {
+	t.Helper()
+	rq, err := newRequest(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rq
+}
@@ -0,0 +1,345 @@
+package konfig
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/krap/root"
+	"github.com/roidaradal/krap/sys"
+	"github.com/roidaradal/rdb"
+	"github.com/roidaradal/rdb/ze"
+)
+
+const (
+	secretTag    string = "secret"  // Struct tag for secret config keys
+	secretPrefix string = "enc:v1:" // Prefix of encrypted config_app values
+	secretKeyLen int    = 32        // AES-256
+)
+
+var (
+	errNoSecretKey      = errors.New("secret key is not set")
+	errInvalidSecretKey = errors.New("secret key must be 32 bytes, base64-encoded")
+	errInvalidSecret    = errors.New("invalid secret value")
+	errSecretField      = errors.New("secret key must be bound to a sys.Secret field")
+)
+
+var secretType = reflect.TypeFor[sys.Secret]()
+
+var (
+	secretMu   sync.RWMutex
+	secretAEAD cipher.AEAD                       // current encryption key
+	secretKeys = dict.NewSyncMap[string, bool]() // registered secret config keys
+)
+
+// Set the secret encryption key from env variable (base64-encoded 32 bytes)
+func LoadSecretKey(envKey string) error {
+	aead, err := newSecretAEAD(os.Getenv(envKey))
+	if err != nil {
+		return fmt.Errorf("%s: %w", envKey, err)
+	}
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretAEAD = aead
+	return nil
+}
+
+// Register config keys whose values are encrypted at rest
+func RegisterSecrets(keys ...string) {
+	for _, key := range keys {
+		secretKeys.Set(key, true)
+	}
+}
+
+// Register the konfig-tagged fields of T that are tagged secret:"true" or typed sys.Secret;
+// secret keys can only be bound to sys.Secret fields, so that they are redacted when displayed
+func RegisterSecretsOf[T any]() {
+	structType := reflect.TypeFor[T]()
+	for _, f := range fieldsOf[T]() {
+		structField := structType.FieldByIndex(f.Index)
+		if structField.Tag.Get(secretTag) == "true" || f.Type == secretType {
+			RegisterSecrets(f.Key)
+		}
+	}
+}
+
+// Check if config key is registered as secret
+func IsSecret(key string) bool {
+	_, ok := secretKeys.Get(key)
+	return ok
+}
+
+// Check that secret config key is bound to a sys.Secret field
+func checkSecretField(key string, t reflect.Type) error {
+	if IsSecret(key) && t != secretType {
+		return fmt.Errorf("%w, not %s", errSecretField, t)
+	}
+	return nil
+}
+
+// Replace the values of secret keys with sys.RedactedText
+func Redact(lookup dict.StringMap) dict.StringMap {
+	redacted := make(dict.StringMap, len(lookup))
+	for key, value := range lookup {
+		if IsSecret(key) || isEncrypted(value) {
+			value = sys.RedactedText
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// Re-encrypts all secret values in config_app, config_app_scoped, and config_app_history
+// under the key in env variable, then switches to the new key; returns number of values re-encrypted
+func RotateSecrets(rq *ze.Request, envKey string) (int, error) {
+	if KVSchema == nil || ScopedKVSchema == nil || ChangeSchema == nil {
+		return 0, ze.ErrMissingSchema
+	}
+	newAEAD, err := newSecretAEAD(os.Getenv(envKey))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", envKey, err)
+	}
+	secretMu.Lock()
+	defer secretMu.Unlock()
+
+	kv, scopedKV := KVSchema.Ref, ScopedKVSchema.Ref
+	rows, err := KVSchema.GetRows(rq, rdb.Prefix(&kv.Value, secretPrefix))
+	if err != nil {
+		return 0, err
+	}
+	scopedRows, err := ScopedKVSchema.GetRows(rq, rdb.Prefix(&scopedKV.Value, secretPrefix))
+	if err != nil {
+		return 0, err
+	}
+	changes, err := encryptedChanges(rq)
+	if err != nil {
+		return 0, err
+	}
+	count := len(rows) + len(scopedRows) + len(changes)
+	if count == 0 {
+		secretAEAD = newAEAD
+		return 0, nil
+	}
+
+	// Re-encrypt all values before writing, so a bad value aborts the rotation
+	values := make([]string, 0, count)
+	for _, row := range rows {
+		value, err := reencrypt(row.Value, newAEAD)
+		if err != nil {
+			rq.AddFmtLog("Failed to decrypt secret %s", row.Key)
+			rq.Status = ze.Err500
+			return 0, err
+		}
+		values = append(values, value)
+	}
+	for _, row := range scopedRows {
+		value, err := reencrypt(row.Value, newAEAD)
+		if err != nil {
+			rq.AddFmtLog("Failed to decrypt secret %s of %s", row.Key, row.Scope)
+			rq.Status = ze.Err500
+			return 0, err
+		}
+		values = append(values, value)
+	}
+	changeValues := make([][2]*string, len(changes)) // OldValue, NewValue
+	for i, change := range changes {
+		for j, value := range []*string{change.OldValue, change.NewValue} {
+			if value == nil || !isEncrypted(*value) {
+				changeValues[i][j] = value
+				continue
+			}
+			sealed, err := reencrypt(*value, newAEAD)
+			if err != nil {
+				// sealed by an older key: kept as is, Rollback rejects it
+				rq.AddFmtLog("Skipped secret %s of change %d: %v", change.Key, change.ID, err)
+				sealed = *value
+			}
+			changeValues[i][j] = &sealed
+		}
+	}
+
+	err = rq.StartTransaction(count)
+	if err != nil {
+		return 0, err
+	}
+	now := clock.DateTimeNow()
+	for i, row := range rows {
+		updates := rdb.FieldUpdates{
+			rdb.Field(KVSchema.Name, &kv.Value):         {row.Value, values[i]},
+			rdb.Field(KVSchema.Name, &kv.LastUpdatedAt): {row.LastUpdatedAt, now},
+		}
+		err = KVSchema.UpdateTx(rq, updates, rdb.Equal(&kv.Key, row.Key))
+		if err != nil {
+			return 0, err
+		}
+	}
+	for i, row := range scopedRows {
+		updates := rdb.FieldUpdates{
+			rdb.Field(ScopedKVSchema.Name, &scopedKV.Value):         {row.Value, values[len(rows)+i]},
+			rdb.Field(ScopedKVSchema.Name, &scopedKV.LastUpdatedAt): {row.LastUpdatedAt, now},
+		}
+		condition := rdb.And(rdb.Equal(&scopedKV.Scope, row.Scope), rdb.Equal(&scopedKV.Key, row.Key))
+		err = ScopedKVSchema.UpdateTx(rq, updates, condition)
+		if err != nil {
+			return 0, err
+		}
+	}
+	ch := ChangeSchema.Ref
+	for i, change := range changes {
+		updates := rdb.FieldUpdates{
+			rdb.Field(ChangeSchema.Name, &ch.OldValue): {change.OldValue, changeValues[i][0]},
+			rdb.Field(ChangeSchema.Name, &ch.NewValue): {change.NewValue, changeValues[i][1]},
+		}
+		err = ChangeSchema.UpdateTx(rq, updates, rdb.Equal(&ch.ID, change.ID))
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = rq.CommitTransaction()
+	if err != nil {
+		return 0, err
+	}
+	secretAEAD = newAEAD
+	rq.AddFmtLog("Rotated secrets: %d", count)
+	return count, nil
+}
+
+// Root command: config/rotate-secrets <ENV_KEY>
+func RotateSecretsCommand() *root.CmdConfig {
+	return root.NewCommand("config/rotate-secrets", 1, "<ENV_KEY> Re-encrypt all secret config values under the key in env variable", func(params []string) {
+		rq, err := ze.NewRequest("konfig.RotateSecrets")
+		if err == nil {
+			_, err = RotateSecrets(rq, params[0])
+		}
+		sys.DisplayOutput(rq, err)
+	})
+}
+
+// Get the config_app_history rows with encrypted old or new values
+func encryptedChanges(rq *ze.Request) ([]*Change, error) {
+	rows, err := ChangeSchema.GetAllRows(rq)
+	if err != nil {
+		rq.AddLog("Failed to load app config history")
+		return nil, err
+	}
+	changes := make([]*Change, 0)
+	for _, row := range rows {
+		hasOld := row.OldValue != nil && isEncrypted(*row.OldValue)
+		hasNew := row.NewValue != nil && isEncrypted(*row.NewValue)
+		if hasOld || hasNew {
+			changes = append(changes, row)
+		}
+	}
+	return changes, nil
+}
+
+// Decrypt the encrypted values of lookup in place
+func decryptLookup(lookup dict.StringMap) error {
+	for key, value := range lookup {
+		if !isEncrypted(value) {
+			continue
+		}
+		plain, err := decryptValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		lookup[key] = plain
+	}
+	return nil
+}
+
+// Get the value to store for config key: encrypts values of secret keys,
+// already-encrypted values are stored as is
+func sealValue(key, value string) (string, error) {
+	if isEncrypted(value) || !IsSecret(key) {
+		return value, nil
+	}
+	secretMu.RLock()
+	defer secretMu.RUnlock()
+	if secretAEAD == nil {
+		return "", errNoSecretKey
+	}
+	return encrypt(value, secretAEAD)
+}
+
+// Get the plain text of stored value: decrypts encrypted values
+func openValue(value string) (string, error) {
+	if !isEncrypted(value) {
+		return value, nil
+	}
+	return decryptValue(value)
+}
+
+// Check if stored value is encrypted
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// Decrypt value using the current key
+func decryptValue(value string) (string, error) {
+	secretMu.RLock()
+	defer secretMu.RUnlock()
+	if secretAEAD == nil {
+		return "", errNoSecretKey
+	}
+	return decrypt(value, secretAEAD)
+}
+
+// Decrypt value using the current key, encrypt using the new key;
+// must be called while holding secretMu
+func reencrypt(value string, newAEAD cipher.AEAD) (string, error) {
+	if secretAEAD == nil {
+		return "", errNoSecretKey
+	}
+	plain, err := decrypt(value, secretAEAD)
+	if err != nil {
+		return "", err
+	}
+	return encrypt(plain, newAEAD)
+}
+
+// Encrypt plain text: <secretPrefix><base64(nonce + ciphertext)>
+func encrypt(plain string, aead cipher.AEAD) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt <secretPrefix><base64(nonce + ciphertext)>
+func decrypt(value string, aead cipher.AEAD) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errInvalidSecret
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errInvalidSecret
+	}
+	return string(plain), nil
+}
+
+// Create AES-GCM cipher from base64-encoded 32-byte key
+func newSecretAEAD(encodedKey string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil || len(key) != secretKeyLen {
+		return nil, errInvalidSecretKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,176 @@
+package konfig
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/krap/daemon"
+	"github.com/roidaradal/krap/sys"
+	"github.com/roidaradal/rdb"
+	"github.com/roidaradal/rdb/ze"
+)
+
+// Called with the sorted list of config keys that changed
+type Subscriber = func(changedKeys []string)
+
+// Live config: holds an atomically swapped snapshot of config T,
+// which can be reloaded from config_app and notifies subscribers of changes
+type Store[T any] struct {
+	snapshot    atomic.Pointer[T]
+	mu          sync.Mutex // guards reloads, lookup, version, loadedAt, subscribers
+	lookup      dict.StringMap
+	version     storeVersion
+	loadedAt    ze.DateTime // start of the last reload, to detect writes within the same second
+	subscribers []Subscriber
+}
+
+// Detects config_app changes without loading all rows:
+// number of rows and latest LastUpdatedAt of the store keys
+type storeVersion struct {
+	count         int
+	lastUpdatedAt ze.DateTime
+}
+
+// Creates a new Store and loads the initial snapshot of config T
+func NewStore[T any](rq *ze.Request) (*Store[T], error) {
+	s := &Store[T]{
+		lookup:      make(dict.StringMap),
+		subscribers: make([]Subscriber, 0),
+	}
+	_, err := s.Reload(rq)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get the current config snapshot; do not modify the returned object
+func (s *Store[T]) Get() *T {
+	return s.snapshot.Load()
+}
+
+// Register a subscriber, called after every reload that changes at least one key
+func (s *Store[T]) Subscribe(subscriber Subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, subscriber)
+}
+
+// Reloads the snapshot if config_app rows of the store keys changed since the last reload,
+// returns the list of changed keys. On error, the current snapshot is kept.
+// Note: for DBStore, changes are detected through row count and LastUpdatedAt, so direct edits
+// to config_app must also update LastUpdatedAt; values are also compared if LastUpdatedAt
+// is not before the last reload (second resolution). Other stores are always compared by value
+func (s *Store[T]) Reload(rq *ze.Request) ([]string, error) {
+	changedKeys, subscribers, err := s.reload(rq)
+	if err != nil {
+		return nil, err
+	}
+	for _, subscriber := range subscribers {
+		subscriber(changedKeys)
+	}
+	return changedKeys, nil
+}
+
+// Swaps the snapshot if config changed, returns the changed keys
+// and the subscribers to notify (none on first load)
+func (s *Store[T]) reload(rq *ze.Request) ([]string, []Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := Keys[T]()
+	loadedAt := clock.DateTimeNow()
+	var version storeVersion
+	if _, isDB := CurrentKVStore().(DBStore); isDB {
+		var err error
+		version, err = loadVersion(rq, keys)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Same version is only unchanged if the last write was before the last reload's second
+		if s.snapshot.Load() != nil && version == s.version && version.lastUpdatedAt < s.loadedAt {
+			return []string{}, nil, nil
+		}
+	}
+
+	lookup, err := Lookup(rq, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := Bind(new(T), lookup)
+	if err != nil {
+		rq.AddErrorLog(err)
+		rq.Status = ze.Err500
+		return nil, nil, err
+	}
+
+	changedKeys := make([]string, 0)
+	for _, key := range keys {
+		oldValue, hadKey := s.lookup[key]
+		newValue, hasKey := lookup[key]
+		if hadKey != hasKey || oldValue != newValue {
+			changedKeys = append(changedKeys, key)
+		}
+	}
+	slices.Sort(changedKeys)
+
+	isFirstLoad := s.snapshot.Load() == nil
+	s.snapshot.Store(cfg)
+	s.lookup = lookup
+	s.version = version
+	s.loadedAt = loadedAt
+	if isFirstLoad || len(changedKeys) == 0 {
+		return changedKeys, nil, nil
+	}
+
+	rq.AddFmtLog("Config reloaded: %v", changedKeys)
+	return changedKeys, slices.Clone(s.subscribers), nil
+}
+
+// Runs a daemon that reloads the store every given interval, returns the daemon handle;
+// TimeScale = time.Hour, time.Minute, time.Second
+func (s *Store[T]) Watch(name string, interval int, timeScale time.Duration) *daemon.Handle {
+	return daemon.Run(name, func() {
+		rq, err := newRequest("konfig.Watch: %s", name)
+		if err == nil {
+			_, err = s.Reload(rq)
+		}
+		sys.DisplayResult(rq, err)
+	}, interval, timeScale)
+}
+
+// Get the current row count and latest LastUpdatedAt of the given keys
+func loadVersion(rq *ze.Request, keys []string) (storeVersion, error) {
+	var version storeVersion
+	if KVSchema == nil {
+		return version, ze.ErrMissingSchema
+	}
+	kv := KVSchema.Ref
+	condition := rdb.In(&kv.Key, keys)
+	count, err := KVSchema.Count(rq, condition)
+	if err != nil {
+		rq.AddLog("Failed to count app config rows")
+		return version, err
+	}
+	version.count = count
+	if count == 0 {
+		return version, nil
+	}
+	q := rdb.NewTopValueQuery[KV](KVSchema.Table, &kv.LastUpdatedAt)
+	q.Where(condition)
+	q.OrderDesc(rdb.Column(&kv.LastUpdatedAt))
+	lastUpdatedAt, err := q.QueryValue(rq.DB)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		rq.AddLog("Failed to load app config last update")
+		rq.Status = ze.Err500
+		return version, err
+	}
+	version.lastUpdatedAt = lastUpdatedAt
+	return version, nil
+}
@@ -0,0 +1,79 @@
+package konfig
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/roidaradal/fn/dict"
+)
+
+func TestStoreReload(t *testing.T) {
+	store := useMemoryStore(t, dict.StringMap{
+		"Billing.DueDays":  "45",
+		"Billing.Currency": "EUR",
+	})
+	s, err := NewStore[testAppConfig](newTestRequest(t))
+	if err != nil {
+		t.Fatalf("NewStore error: %v", err)
+	}
+	if s.Get().Billing.DueDays != 45 {
+		t.Fatalf("DueDays = %d, want 45", s.Get().Billing.DueDays)
+	}
+	var notified [][]string
+	s.Subscribe(func(changedKeys []string) {
+		notified = append(notified, changedKeys)
+	})
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"no change", func() {}, []string{}},
+		{"same value", func() { store.Set("Billing.DueDays", "45") }, []string{}},
+		{"unrelated key", func() { store.Set("Other.Key", "1") }, []string{}},
+		{"changed values", func() {
+			store.Set("Billing.DueDays", "60")
+			store.Set("Billing.Audit.Enabled", "false")
+		}, []string{"Billing.Audit.Enabled", "Billing.DueDays"}},
+		{"deleted key", func() { store.Delete("Billing.Currency") }, []string{"Billing.Currency"}},
+	}
+	for _, step := range steps {
+		notified = nil
+		step.change()
+		got, err := s.Reload(newTestRequest(t))
+		if err != nil {
+			t.Fatalf("%s: Reload error: %v", step.name, err)
+		}
+		if !slices.Equal(got, step.want) {
+			t.Errorf("%s: Reload = %v, want %v", step.name, got, step.want)
+		}
+		if len(step.want) == 0 && len(notified) > 0 {
+			t.Errorf("%s: subscribers notified without changes", step.name)
+		}
+		if len(step.want) > 0 && (len(notified) != 1 || !slices.Equal(notified[0], step.want)) {
+			t.Errorf("%s: subscribers notified with %v, want %v", step.name, notified, step.want)
+		}
+	}
+
+	want := testBillingConfig{DueDays: 60, Currency: "USD", Audit: testAuditConfig{Enabled: false, Retain: 30}}
+	if s.Get().Billing != want {
+		t.Errorf("Billing = %+v, want %+v", s.Get().Billing, want)
+	}
+}
+
+func TestStoreReloadKeepsSnapshotOnError(t *testing.T) {
+	store := useMemoryStore(t, dict.StringMap{"Billing.DueDays": "45"})
+	s, err := NewStore[testAppConfig](newTestRequest(t))
+	if err != nil {
+		t.Fatalf("NewStore error: %v", err)
+	}
+	before := s.Get()
+	store.Set("Billing.DueDays", "soon")
+	if _, err := s.Reload(newTestRequest(t)); err == nil {
+		t.Fatal("Reload of invalid value = nil error")
+	}
+	if s.Get() != before {
+		t.Error("snapshot replaced by invalid config")
+	}
+}
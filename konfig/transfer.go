@@ -0,0 +1,175 @@
+package konfig
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/krap/root"
+	"github.com/roidaradal/krap/sys"
+	"github.com/roidaradal/rdb/ze"
+)
+
+// Old and new value of a config key
+type ValueChange struct {
+	Old string
+	New string
+}
+
+// Difference between config_app and an imported config file
+type ConfigDiff struct {
+	Added   dict.StringMap         // keys in file, not in config_app
+	Changed map[string]ValueChange // keys with different values
+	Removed []string               // keys in config_app, not in file
+}
+
+// Check if diff has any changes
+func (d *ConfigDiff) HasChanges() bool {
+	return len(d.Added) > 0 || len(d.Changed) > 0 || len(d.Removed) > 0
+}
+
+// Exports the config of the given domains (all if none) to a JSON or YAML file (by extension),
+// as flat <Domain>.<Key> => value entries; secret keys are not exported.
+// Returns the number of exported keys
+func Export(rq *ze.Request, path string, domains ...string) (int, error) {
+	lookup, err := exportLookup(rq, CurrentKVStore(), domains)
+	if err != nil {
+		return 0, err
+	}
+	var data []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(lookup)
+	default:
+		data, err = json.MarshalIndent(lookup, "", "  ")
+	}
+	if err != nil {
+		return 0, err
+	}
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		rq.AddFmtLog("Failed to write config to %s", path)
+		rq.Status = ze.Err500
+		return 0, err
+	}
+	return len(lookup), nil
+}
+
+// Imports a JSON or YAML config file into config_app: keys of the given domains (all if none)
+// are added, changed, or removed to match the file; secret keys are left as is.
+// If dryRun, only returns the diff; otherwise applies it and records the changes in history
+func Import(rq *ze.Request, path string, domains []string, dryRun bool, updatedBy string) (*ConfigDiff, error) {
+	incoming, err := readConfigFile(path)
+	if err != nil {
+		rq.AddFmtLog("Failed to read config from %s", path)
+		rq.Status = ze.Err400
+		return nil, err
+	}
+	current, err := exportLookup(rq, DBStore{}, domains)
+	if err != nil {
+		return nil, err
+	}
+	if len(domains) > 0 {
+		incoming = pickPrefixes(incoming, domainPrefixes(domains))
+	}
+
+	diff := &ConfigDiff{
+		Added:   make(dict.StringMap),
+		Changed: make(map[string]ValueChange),
+		Removed: make([]string, 0),
+	}
+	changes := make(map[string]*string)
+	for key, value := range incoming {
+		if IsSecret(key) {
+			continue
+		}
+		oldValue, exists := current[key]
+		switch {
+		case !exists:
+			diff.Added[key] = value
+		case oldValue != value:
+			diff.Changed[key] = ValueChange{Old: oldValue, New: value}
+		default:
+			continue
+		}
+		changes[key] = &value
+	}
+	for key := range current {
+		if dict.NoKey(incoming, key) {
+			diff.Removed = append(diff.Removed, key)
+			changes[key] = nil
+		}
+	}
+	slices.Sort(diff.Removed)
+	if dryRun || len(changes) == 0 {
+		return diff, nil
+	}
+	err = applyChanges(rq, changes, updatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// Root commands: config/export, config/diff, config/import
+func TransferCommands(updatedBy string) []*root.CmdConfig {
+	return []*root.CmdConfig{
+		root.NewCommand("config/export", 1, "<PATH> [DOMAINS...] Export config to JSON / YAML file", func(params []string) {
+			rq, err := newRequest("konfig.Export")
+			var count int
+			if err == nil {
+				count, err = Export(rq, params[0], params[1:]...)
+			}
+			sys.DisplayData(&count, rq, err)
+		}),
+		root.NewCommand("config/diff", 1, "<PATH> [DOMAINS...] Show changes that importing the config file would make", func(params []string) {
+			rq, err := ze.NewRequest("konfig.Import")
+			var diff *ConfigDiff
+			if err == nil {
+				diff, err = Import(rq, params[0], params[1:], true, updatedBy)
+			}
+			sys.DisplayData(diff, rq, err)
+		}),
+		root.NewCommand("config/import", 1, "<PATH> [DOMAINS...] Import config file: add, change, and remove keys to match it", func(params []string) {
+			rq, err := ze.NewRequest("konfig.Import")
+			var diff *ConfigDiff
+			if err == nil {
+				diff, err = Import(rq, params[0], params[1:], false, updatedBy)
+			}
+			sys.DisplayData(diff, rq, err)
+		}),
+	}
+}
+
+// Get the stored values of the given domains (all if none), without secret keys
+func exportLookup(rq *ze.Request, store KVStore, domains []string) (dict.StringMap, error) {
+	var lookup dict.StringMap
+	var err error
+	if len(domains) == 0 {
+		lookup, err = store.All(rq)
+	} else {
+		lookup, err = store.PrefixLookup(rq, domainPrefixes(domains))
+	}
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range lookup {
+		if IsSecret(key) || isEncrypted(value) {
+			delete(lookup, key)
+		}
+	}
+	return lookup, nil
+}
+
+// Get the key prefixes of domains: Session or Session.* => Session.
+func domainPrefixes(domains []string) []string {
+	prefixes := make([]string, len(domains))
+	for i, domain := range domains {
+		prefixes[i] = strings.TrimSuffix(domain, domainSuffix) + keyGlue
+	}
+	return prefixes
+}
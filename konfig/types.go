@@ -1,12 +1,19 @@
 package konfig
 
 import (
+	"time"
+
 	"github.com/roidaradal/fn/dict"
 	"github.com/roidaradal/rdb/ze"
 )
 
 var (
-	KVSchema *ze.Schema[KV]
+	KVSchema       *ze.Schema[KV]
+	ScopedKVSchema *ze.Schema[ScopedKV]
+	ChangeSchema   *ze.Schema[Change]
+
+	FeatureSchema       *ze.Schema[Feature]
+	ScopedFeatureSchema *ze.Schema[ScopedFeature]
 )
 
 type KV struct {
@@ -15,9 +22,67 @@ type KV struct {
 	LastUpdatedAt ze.DateTime
 }
 
+// Scope-specific override of config_app value
+type ScopedKV struct {
+	Scope         string
+	Key           string `col:"AppKey"`
+	Value         string `col:"AppValue"`
+	LastUpdatedAt ze.DateTime
+}
+
+// Config change history: OldValue is nil for new keys, NewValue is nil for deleted keys
+type Change struct {
+	ID        ze.ID
+	Key       string `col:"AppKey"`
+	OldValue  *string
+	NewValue  *string
+	UpdatedBy string
+	UpdatedAt ze.DateTime
+}
+
+// Feature flag: on if IsActive and now is within [StartAt, EndAt),
+// Rollout is the percentage (1-100) of IDs the feature is on for, 0 = unset (100),
+// so plain boolean flags only need IsActive
+type Feature struct {
+	Name     string `col:"Feature"`
+	IsActive bool
+	Rollout  uint
+	StartAt  *ze.DateTime
+	EndAt    *ze.DateTime
+}
+
+// Scope-specific override of feature flag
+type ScopedFeature struct {
+	Scope    string
+	Name     string `col:"Feature"`
+	IsActive bool
+}
+
 type Defaults struct {
 	UintMap       map[string]uint
 	IntMap        map[string]int
+	FloatMap      map[string]float64
+	BoolMap       map[string]bool
 	StringMap     dict.StringMap
 	StringListMap dict.StringListMap
+	StringMapMap  map[string]dict.StringMap
+	DurationMap   map[string]time.Duration
+	TimeMap       map[string]time.Time
+	JSONMap       map[string]any // default values must match the field types
+}
+
+// Get all config keys in Defaults
+func (d *Defaults) Keys() []string {
+	keys := make([]string, 0)
+	keys = append(keys, dict.Keys(d.UintMap)...)
+	keys = append(keys, dict.Keys(d.IntMap)...)
+	keys = append(keys, dict.Keys(d.FloatMap)...)
+	keys = append(keys, dict.Keys(d.BoolMap)...)
+	keys = append(keys, dict.Keys(d.StringMap)...)
+	keys = append(keys, dict.Keys(d.StringListMap)...)
+	keys = append(keys, dict.Keys(d.StringMapMap)...)
+	keys = append(keys, dict.Keys(d.DurationMap)...)
+	keys = append(keys, dict.Keys(d.TimeMap)...)
+	keys = append(keys, dict.Keys(d.JSONMap)...)
+	return keys
 }
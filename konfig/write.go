@@ -0,0 +1,210 @@
+package konfig
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/roidaradal/fn/clock"
+	"github.com/roidaradal/fn/dict"
+	"github.com/roidaradal/krap/sys"
+	"github.com/roidaradal/rdb"
+	"github.com/roidaradal/rdb/ze"
+)
+
+var (
+	errNoChange    = errors.New("config change not found")
+	errStaleSecret = errors.New("config change value was encrypted with another secret key")
+)
+
+// Sets the config key to value, records the change in history
+func Set(rq *ze.Request, key, value, updatedBy string) error {
+	return SetMany(rq, dict.StringMap{key: value}, updatedBy)
+}
+
+// Sets multiple config keys in one transaction, records the changes in history
+func SetMany(rq *ze.Request, values dict.StringMap, updatedBy string) error {
+	changes := make(map[string]*string, len(values))
+	for key, value := range values {
+		changes[key] = &value
+	}
+	return applyChanges(rq, changes, updatedBy)
+}
+
+// Deletes the config keys in one transaction, records the changes in history
+func Delete(rq *ze.Request, keys []string, updatedBy string) error {
+	changes := make(map[string]*string, len(keys))
+	for _, key := range keys {
+		changes[key] = nil
+	}
+	return applyChanges(rq, changes, updatedBy)
+}
+
+// Get the change history of config key, latest first; secret values are redacted
+func History(rq *ze.Request, key string) ([]*Change, error) {
+	if ChangeSchema == nil {
+		return nil, ze.ErrMissingSchema
+	}
+	change := ChangeSchema.Ref
+	q := rdb.NewFullSelectRowsQuery(ChangeSchema.Table, ChangeSchema.Reader)
+	q.Where(rdb.Equal(&change.Key, key))
+	q.OrderDesc(rdb.Column(&change.ID))
+	changes, err := q.Query(rq.DB)
+	if err != nil {
+		rq.AddFmtLog("Failed to load config history of %s", key)
+		rq.Status = ze.Err500
+		return nil, err
+	}
+	for _, change := range changes {
+		change.OldValue = redactValue(key, change.OldValue)
+		change.NewValue = redactValue(key, change.NewValue)
+	}
+	return changes, nil
+}
+
+// Rolls back a config key to the value it was set to by the given change;
+// the rollback itself is recorded as a new change
+func Rollback(rq *ze.Request, changeID ze.ID, updatedBy string) error {
+	if ChangeSchema == nil {
+		return ze.ErrMissingSchema
+	}
+	ref := ChangeSchema.Ref
+	changes, err := ChangeSchema.GetRows(rq, rdb.Equal(&ref.ID, changeID))
+	if err != nil {
+		rq.AddFmtLog("Failed to load config change %d", changeID)
+		return err
+	}
+	if len(changes) == 0 {
+		rq.Status = ze.Err404
+		return errNoChange
+	}
+	change := changes[0]
+	if change.NewValue != nil && isEncrypted(*change.NewValue) {
+		if _, err := openValue(*change.NewValue); err != nil {
+			rq.AddFmtLog("Config change %d was encrypted with another secret key", changeID)
+			rq.Status = ze.Err400
+			return errStaleSecret
+		}
+	}
+	return applyChanges(rq, map[string]*string{change.Key: change.NewValue}, updatedBy)
+}
+
+// Common: upserts (value != nil) or deletes (value == nil) the config keys,
+// stamps LastUpdatedAt, and adds the history rows in one transaction
+func applyChanges(rq *ze.Request, changes map[string]*string, updatedBy string) error {
+	if KVSchema == nil || ChangeSchema == nil {
+		return ze.ErrMissingSchema
+	}
+	keys := dict.Keys(changes)
+	slices.Sort(keys)
+	current, err := DBStore{}.Lookup(rq, keys)
+	if err != nil {
+		return err
+	}
+
+	// Skip keys that will not change, encrypt secret values
+	now := clock.DateTimeNow()
+	history := make([]*Change, 0, len(keys))
+	for _, key := range keys {
+		newValue := changes[key]
+		oldValue, exists := current[key]
+		if !exists && newValue == nil {
+			continue // delete missing key
+		}
+		if newValue != nil {
+			same, err := sameValue(oldValue, *newValue)
+			if err != nil {
+				rq.AddFmtLog("Failed to decrypt secret %s", key)
+				rq.Status = ze.Err500
+				return err
+			}
+			if exists && same {
+				continue // same value
+			}
+			if exists && isEncrypted(oldValue) {
+				RegisterSecrets(key) // keep encrypted keys encrypted
+			}
+			sealed, err := sealValue(key, *newValue)
+			if err != nil {
+				rq.AddFmtLog("Failed to encrypt secret %s", key)
+				rq.Status = ze.Err500
+				return err
+			}
+			newValue = &sealed
+		}
+		change := &Change{
+			Key:       key,
+			NewValue:  newValue,
+			UpdatedBy: updatedBy,
+			UpdatedAt: now,
+		}
+		if exists {
+			change.OldValue = &oldValue
+		}
+		history = append(history, change)
+	}
+	if len(history) == 0 {
+		return nil
+	}
+
+	err = rq.StartTransaction(len(history) + 1)
+	if err != nil {
+		return err
+	}
+	kv := KVSchema.Ref
+	valueField := rdb.Field(KVSchema.Name, &kv.Value)
+	updatedAtField := rdb.Field(KVSchema.Name, &kv.LastUpdatedAt)
+	for _, change := range history {
+		condition := rdb.Equal(&kv.Key, change.Key)
+		switch {
+		case change.NewValue == nil:
+			err = KVSchema.DeleteTx(rq, condition)
+		case change.OldValue == nil:
+			err = KVSchema.InsertTx(rq, &KV{
+				Key:           change.Key,
+				Value:         *change.NewValue,
+				LastUpdatedAt: now,
+			})
+		default:
+			updates := rdb.FieldUpdates{
+				valueField:     {*change.OldValue, *change.NewValue},
+				updatedAtField: {nil, now},
+			}
+			err = KVSchema.UpdateTx(rq, updates, condition)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = ChangeSchema.InsertTxRows(rq, history)
+	if err != nil {
+		return err
+	}
+	err = rq.CommitTransaction()
+	if err != nil {
+		return err
+	}
+	rq.AddFmtLog("Config changes: %d", len(history))
+	return nil
+}
+
+// Check if stored value and new value have the same plain text
+func sameValue(storedValue, newValue string) (bool, error) {
+	oldText, err := openValue(storedValue)
+	if err != nil {
+		return false, err
+	}
+	newText, err := openValue(newValue)
+	if err != nil {
+		return false, err
+	}
+	return oldText == newText, nil
+}
+
+// Replace the secret history value with sys.RedactedText
+func redactValue(key string, value *string) *string {
+	if value == nil || !(IsSecret(key) || isEncrypted(*value)) {
+		return value
+	}
+	redacted := sys.RedactedText
+	return &redacted
+}
@@ -0,0 +1,26 @@
+package sys
+
+const RedactedText string = "********"
+
+// Secret string value: redacted when printed or marshaled to JSON
+type Secret string
+
+// Get the actual secret value
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// Redacted text for fmt
+func (s Secret) String() string {
+	return RedactedText
+}
+
+// Redacted text for fmt %#v
+func (s Secret) GoString() string {
+	return RedactedText
+}
+
+// Redacted text for JSON
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + RedactedText + `"`), nil
+}
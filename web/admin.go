@@ -0,0 +1,54 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/roidaradal/fn/ds"
+	"github.com/roidaradal/krap/daemon"
+	"github.com/roidaradal/krap/konfig"
+	"github.com/roidaradal/rdb/ze"
+)
+
+// GET handler: registered config keys with their current value, default, and docs;
+// filter by ?domain=<Domain> (repeatable), secret values are redacted
+func ConfigListHandler(c *gin.Context) {
+	rq, err := ze.NewRequest("web.ConfigList")
+	var infos []*konfig.KeyInfo
+	if err == nil {
+		infos, err = konfig.ListConfig(rq, c.QueryArray("domain")...)
+	}
+	SendDataResponse(c, ds.NewList(infos), rq, err)
+}
+
+// GET handler: info of all running daemons
+func DaemonListHandler(c *gin.Context) {
+	rq, err := ze.NewRequest("web.DaemonList")
+	var info map[string]daemon.Info
+	if err == nil {
+		info = daemon.All()
+	}
+	SendDataResponse(c, &info, rq, err)
+}
+
+// POST handler: run the :name daemon now
+func DaemonRunHandler(c *gin.Context) {
+	daemonAction(c, "web.DaemonRun", daemon.Trigger)
+}
+
+// POST handler: pause the :name daemon's scheduled runs
+func DaemonPauseHandler(c *gin.Context) {
+	daemonAction(c, "web.DaemonPause", daemon.Pause)
+}
+
+// POST handler: resume the :name daemon's scheduled runs
+func DaemonResumeHandler(c *gin.Context) {
+	daemonAction(c, "web.DaemonResume", daemon.Resume)
+}
+
+// Common: applies action to the :name daemon, sends actionResponse
+func daemonAction(c *gin.Context, name string, action func(string) error) {
+	rq, err := ze.NewRequest(name)
+	if err == nil {
+		err = action(c.Param("name"))
+	}
+	SendActionResponse(c, rq, err)
+}
@@ -0,0 +1,39 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/roidaradal/fn/fail"
+	"github.com/roidaradal/krap/konfig"
+	"github.com/roidaradal/rdb/ze"
+)
+
+// Middleware that responds with 404 if the feature is off
+func RequireFeature(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !konfig.CheckFeature(name) {
+			abortNotFound(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Middleware that responds with 404 if the feature is off for the request's scope
+func RequireScopedFeature(name string, getScope func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !konfig.CheckScopedFeature(getScope(c), name) {
+			abortNotFound(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Common: abort request with 404 dataResponse
+func abortNotFound(c *gin.Context) {
+	message, _ := fail.PublicMessage(fail.NotFoundPath)
+	c.AbortWithStatusJSON(ze.Err404, dataResponse{
+		Data:    nil,
+		Message: message,
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/roidaradal/fn/fail"
 	"github.com/roidaradal/fn/lang"
+	"github.com/roidaradal/krap/daemon"
 	"github.com/roidaradal/rdb/ze"
 )
 
@@ -15,8 +16,9 @@ const okMessage = "OK"
 
 // Map common error => status codes
 var webErrorStatus = map[error]int{
-	fail.MissingParams:  ze.Err400,
-	ze.ErrMissingSchema: ze.Err500,
+	fail.MissingParams:   ze.Err400,
+	ze.ErrMissingSchema:  ze.Err500,
+	daemon.ErrNotRunning: ze.Err404,
 }
 
 // Response for action web requests